@@ -0,0 +1,193 @@
+package tsarw
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+)
+
+var Schema *arrow.Schema = arrow.NewSchema([]arrow.Field{
+	{Name: "id", Type: arrow.BinaryTypes.String},
+	{Name: "date", Type: &arrow.TimestampType{Unit: arrow.Nanosecond, TimeZone: "UTC"}},
+	{Name: "key", Type: arrow.BinaryTypes.Binary},
+	{Name: "val", Type: arrow.BinaryTypes.Binary},
+}, nil)
+
+type rowUser struct {
+	id   *array.StringBuilder
+	date *array.TimestampBuilder
+	key  *array.BinaryBuilder
+	val  *array.BinaryBuilder
+}
+
+func (r *rowUser) UseId(id string)      { r.id.Append(id) }
+func (r *rowUser) UseDate(dt time.Time) { r.date.Append(arrow.Timestamp(dt.UnixNano())) }
+func (r *rowUser) UseKey(key []byte)    { r.key.Append(key) }
+func (r *rowUser) UseVal(val []byte)    { r.val.Append(val) }
+
+type RecordBuilder struct {
+	bld *array.RecordBuilder
+	row rowUser
+}
+
+func RecordBuilderNew(mem memory.Allocator) *RecordBuilder {
+	bld := array.NewRecordBuilder(mem, Schema)
+	return &RecordBuilder{
+		bld: bld,
+		row: rowUser{
+			id:   bld.Field(0).(*array.StringBuilder),
+			date: bld.Field(1).(*array.TimestampBuilder),
+			key:  bld.Field(2).(*array.BinaryBuilder),
+			val:  bld.Field(3).(*array.BinaryBuilder),
+		},
+	}
+}
+
+func (b *RecordBuilder) Append(s sp.TsSample) { s.ForUser(&b.row) }
+func (b *RecordBuilder) Len() int             { return b.row.id.Len() }
+func (b *RecordBuilder) Release()             { b.bld.Release() }
+
+// NewRecordBatch creates a record from the appended samples and resets the builder.
+func (b *RecordBuilder) NewRecordBatch() arrow.RecordBatch { return b.bld.NewRecordBatch() }
+
+// Samples2Records creates records which have at most batchSize rows.
+// The caller must release the records; the builder is released after the last record.
+func Samples2Records(samples s2k.Iter[sp.TsSample], batchSize int, mem memory.Allocator) s2k.Iter[arrow.RecordBatch] {
+	bld := RecordBuilderNew(mem)
+	return func() s2k.Option[arrow.RecordBatch] {
+		if nil == bld {
+			return s2k.OptionEmptyNew[arrow.RecordBatch]()
+		}
+		for o := samples(); o.HasValue(); o = samples() {
+			bld.Append(o.Value())
+			if batchSize <= bld.Len() {
+				return s2k.OptionNew(bld.NewRecordBatch())
+			}
+		}
+		if 0 < bld.Len() {
+			return s2k.OptionNew(bld.NewRecordBatch())
+		}
+		bld.Release()
+		bld = nil
+		return s2k.OptionEmptyNew[arrow.RecordBatch]()
+	}
+}
+
+// Record2Samples creates samples which refer the buffers of the record.
+// The record must not be released while the samples are in use.
+func Record2Samples(rec arrow.RecordBatch) (s2k.Iter[sp.TsSample], error) {
+	if !rec.Schema().Equal(Schema) {
+		return nil, fmt.Errorf("Unexpected schema: %v", rec.Schema())
+	}
+
+	ids := rec.Column(0).(*array.String)
+	dates := rec.Column(1).(*array.Timestamp)
+	keys := rec.Column(2).(*array.Binary)
+	vals := rec.Column(3).(*array.Binary)
+
+	var rows int = int(rec.NumRows())
+	var i int = 0
+	return func() s2k.Option[sp.TsSample] {
+		if rows <= i {
+			return s2k.OptionEmptyNew[sp.TsSample]()
+		}
+		s := sp.TsSampleNew(
+			ids.Value(i),
+			time.Unix(0, int64(dates.Value(i))).UTC(),
+			keys.Value(i),
+			vals.Value(i),
+		)
+		i += 1
+		return s2k.OptionNew(s)
+	}, nil
+}
+
+// WriteIpc writes the samples as an arrow ipc stream.
+func WriteIpc(w io.Writer, samples s2k.Iter[sp.TsSample], batchSize int) error {
+	wtr := ipc.NewWriter(w, ipc.WithSchema(Schema))
+	records := Samples2Records(samples, batchSize, memory.DefaultAllocator)
+	for o := records(); o.HasValue(); o = records() {
+		rec := o.Value()
+		e := wtr.Write(rec)
+		rec.Release()
+		if nil != e {
+			_ = wtr.Close()
+			return e
+		}
+	}
+	return wtr.Close()
+}
+
+type IpcReader struct {
+	rdr *ipc.Reader
+	rec arrow.RecordBatch
+	err error
+}
+
+// IpcReaderNew creates a reader; options(e.g, ipc.WithAllocator) are passed to the ipc reader.
+func IpcReaderNew(r io.Reader, opts ...ipc.Option) (*IpcReader, error) {
+	rdr, e := ipc.NewReader(r, append([]ipc.Option{ipc.WithSchema(Schema)}, opts...)...)
+	if nil != e {
+		return nil, e
+	}
+	return &IpcReader{rdr: rdr}, nil
+}
+
+func (x *IpcReader) releaseRecord() {
+	if nil != x.rec {
+		x.rec.Release()
+		x.rec = nil
+	}
+}
+
+func (x *IpcReader) nextRecord() s2k.Iter[sp.TsSample] {
+	x.releaseRecord()
+	if !x.rdr.Next() {
+		return nil
+	}
+	x.rec = x.rdr.RecordBatch()
+	x.rec.Retain() // the reader releases the record on Next(); samples may still refer it
+	samples, e := Record2Samples(x.rec)
+	if nil != e {
+		x.err = e
+		return nil
+	}
+	return samples
+}
+
+// Samples reads all samples in the stream. Check Err() after the iteration.
+// A sample refers the current record and must not be used after the iterator moves to the next record.
+func (x *IpcReader) Samples() s2k.Iter[sp.TsSample] {
+	var current s2k.Iter[sp.TsSample] = s2k.IterEmptyNew[sp.TsSample]()
+	return func() s2k.Option[sp.TsSample] {
+		for nil != current {
+			o := current()
+			if o.HasValue() {
+				return o
+			}
+			current = x.nextRecord()
+		}
+		return s2k.OptionEmptyNew[sp.TsSample]()
+	}
+}
+
+func (x *IpcReader) Err() error {
+	if nil != x.err {
+		return x.err
+	}
+	return x.rdr.Err()
+}
+
+func (x *IpcReader) Release() {
+	x.releaseRecord()
+	x.rdr.Release()
+}
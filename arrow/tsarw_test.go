@@ -0,0 +1,125 @@
+package tsarw
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+)
+
+func checker[T comparable](t *testing.T, got T, expected T) {
+	if got != expected {
+		t.Errorf("Unexpected value got.\n")
+		t.Errorf("expected: %v\n", expected)
+		t.Errorf("got:      %v\n", got)
+	}
+}
+
+type sampleDto struct {
+	id   string
+	date time.Time
+	key  []byte
+	val  []byte
+}
+
+func (s *sampleDto) UseId(id string)      { s.id = id }
+func (s *sampleDto) UseDate(dt time.Time) { s.date = dt }
+func (s *sampleDto) UseKey(k []byte)      { s.key = k }
+func (s *sampleDto) UseVal(v []byte)      { s.val = v }
+
+func TestTsarw(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 1, 2, 3, 456, time.UTC)
+	samplesNew := func() s2k.Iter[sp.TsSample] {
+		return s2k.IterFromArray([]sp.TsSample{
+			sp.TsSampleNew("i0", dt, []byte("k0"), []byte("v0")),
+			sp.TsSampleNew("i1", dt, []byte("k1"), []byte("v1")),
+			sp.TsSampleNew("i2", dt, []byte("k2"), []byte("v2")),
+		})
+	}
+
+	t.Run("Samples2Records", func(t *testing.T) {
+		t.Parallel()
+
+		mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+		records := Samples2Records(samplesNew(), 2, mem)
+		var recs []arrow.RecordBatch = records.ToArray()
+		checker(t, len(recs), 2)
+		checker(t, recs[0].NumRows(), 2)
+		checker(t, recs[1].NumRows(), 1)
+
+		samples, e := Record2Samples(recs[1])
+		if nil != e {
+			t.Fatalf("Unable to convert: %v", e)
+		}
+		var s sampleDto
+		samples().Value().ForUser(&s)
+		checker(t, s.id, "i2")
+		checker(t, s.date.Equal(dt), true)
+		checker(t, string(s.key), "k2")
+		checker(t, string(s.val), "v2")
+		checker(t, samples().HasValue(), false)
+
+		for _, rec := range recs {
+			rec.Release()
+		}
+		mem.AssertSize(t, 0)
+	})
+
+	t.Run("ipc", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		e := WriteIpc(&buf, samplesNew(), 2)
+		if nil != e {
+			t.Fatalf("Unable to write: %v", e)
+		}
+
+		mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+		rdr, e := IpcReaderNew(&buf, ipc.WithAllocator(mem))
+		if nil != e {
+			t.Fatalf("Unable to read: %v", e)
+		}
+
+		// samples must be used before reading the next record
+		var got []string = s2k.IterMap(rdr.Samples(), func(s sp.TsSample) string {
+			var d sampleDto
+			s.ForUser(&d)
+			return fmt.Sprintf("%s:%s", d.id, d.val)
+		}).ToArray()
+		if nil != rdr.Err() {
+			t.Errorf("Unexpected error: %v", rdr.Err())
+		}
+		checker(t, len(got), 3)
+		checker(t, got[1], "i1:v1")
+
+		rdr.Release()
+		mem.AssertSize(t, 0)
+	})
+
+	t.Run("ipc empty", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		e := WriteIpc(&buf, s2k.IterEmptyNew[sp.TsSample](), 2)
+		if nil != e {
+			t.Fatalf("Unable to write: %v", e)
+		}
+
+		rdr, e := IpcReaderNew(&buf)
+		if nil != e {
+			t.Fatalf("Unable to read: %v", e)
+		}
+		defer rdr.Release()
+		checker(t, rdr.Samples().Count(), 0)
+	})
+}
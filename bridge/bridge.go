@@ -0,0 +1,241 @@
+// Package bridge writes messages of pub/sub topics(e.g. MQTT) as samples.
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	tskey "github.com/takanoriyanagitani/go-spacetimedb/key"
+	vlcb "github.com/takanoriyanagitani/go-spacetimedb/vlog/cbor"
+)
+
+const defaultBatchSize int = 1024
+
+type Message struct {
+	Topic    string
+	Payload  []byte
+	Received time.Time
+}
+
+// Subscriber delivers messages of topics which match the filter(MQTT style) until the context is done.
+// Implementations adapt broker clients.
+type Subscriber interface {
+	Subscribe(ctx context.Context, filter string, handler func(ctx context.Context, m Message) error) error
+}
+
+// TopicPattern extracts the device id from topics.
+//
+//	{id}: the device id(a level)
+//	+:    any level
+//	#:    any levels(must be the last level)
+//
+// e.g. site/{id}/telemetry, +/{id}/#
+type TopicPattern struct {
+	levels []string
+	idx    int // level of the id
+}
+
+func TopicPatternNew(pattern string) (TopicPattern, error) {
+	var levels []string = strings.Split(pattern, "/")
+	var idx int = -1
+	for i, level := range levels {
+		switch level {
+		case "{id}":
+			if 0 <= idx {
+				return TopicPattern{}, fmt.Errorf("Multiple ids: %s", pattern)
+			}
+			idx = i
+		case "#":
+			if len(levels)-1 != i {
+				return TopicPattern{}, fmt.Errorf("# must be the last level: %s", pattern)
+			}
+		}
+	}
+	if idx < 0 {
+		return TopicPattern{}, fmt.Errorf("No id: %s", pattern)
+	}
+	return TopicPattern{levels: levels, idx: idx}, nil
+}
+
+// Filter gets the topic filter to subscribe.
+func (p TopicPattern) Filter() string {
+	filter := append([]string(nil), p.levels...)
+	filter[p.idx] = "+"
+	return strings.Join(filter, "/")
+}
+
+// Match gets the id in the topic.
+func (p TopicPattern) Match(topic string) (id string, ok bool) {
+	var levels []string = strings.Split(topic, "/")
+	for i, pat := range p.levels {
+		if "#" == pat {
+			break
+		}
+		if len(levels) <= i {
+			return "", false
+		}
+		switch pat {
+		case "{id}":
+			id = levels[i]
+		case "+":
+		default:
+			if pat != levels[i] {
+				return "", false
+			}
+		}
+	}
+	if "#" != p.levels[len(p.levels)-1] && len(levels) != len(p.levels) {
+		return "", false
+	}
+	return id, "" != id
+}
+
+// MatchFilter checks if the topic matches the MQTT style filter(+, #).
+func MatchFilter(filter, topic string) bool {
+	var fl []string = strings.Split(filter, "/")
+	var tl []string = strings.Split(topic, "/")
+	for i, f := range fl {
+		if "#" == f {
+			return true
+		}
+		if len(tl) <= i || ("+" != f && f != tl[i]) {
+			return false
+		}
+	}
+	return len(fl) == len(tl)
+}
+
+// PayloadDecoder converts the message of the device to samples.
+type PayloadDecoder func(id string, m Message) ([]sp.TsSample, error)
+
+// VlogDecoder unpacks payloads using the vlog.
+// Samples without ids get the id of the topic; samples of other devices are rejected.
+func VlogDecoder(v sp.Vlog) PayloadDecoder {
+	return func(id string, m Message) ([]sp.TsSample, error) {
+		unpacked, e := v.Unpack(m.Payload)
+		if nil != e {
+			return nil, e
+		}
+		samples := make([]sp.TsSample, 0, len(unpacked))
+		for _, s := range unpacked {
+			var dto vlcb.SampleDto
+			s.ForUser(&dto)
+			switch dto.Id {
+			case "":
+				dto.Id = id
+			case id:
+			default:
+				return nil, fmt.Errorf("Unexpected id(%s) in the topic of %s", dto.Id, id)
+			}
+			samples = append(samples, dto.ToSample())
+		}
+		return samples, nil
+	}
+}
+
+// RawDecoder stores the payload as is.
+//
+//	key: the received time(tskey.Time)
+//	val: the payload
+func RawDecoder(id string, m Message) ([]sp.TsSample, error) {
+	return []sp.TsSample{sp.TsSampleNew(id, m.Received, tskey.Time(m.Received), m.Payload)}, nil
+}
+
+// FromSet writes samples one by one using the setter.
+func FromSet(set sp.Set) sp.BatchSet {
+	return func(ctx context.Context, many s2k.Iter[sp.TsSample]) error {
+		for o := many(); o.HasValue(); o = many() {
+			var dto vlcb.SampleDto
+			o.Value().ForUser(&dto)
+			e := set(ctx, dto.Id, dto.Date, dto.Key, dto.Val)
+			if nil != e {
+				return e
+			}
+		}
+		return nil
+	}
+}
+
+type Bridge struct {
+	sub       Subscriber
+	pattern   TopicPattern
+	decode    PayloadDecoder
+	bset      sp.BatchSet
+	batchSize int
+	validate  func(id string) error
+	onErr     func(m Message, e error)
+	now       func() time.Time
+}
+
+type BridgeOption func(b *Bridge)
+
+// WithIdValidator rejects messages of invalid devices(default: sp.DefaultIdValidator).
+func WithIdValidator(v func(id string) error) BridgeOption {
+	return func(b *Bridge) { b.validate = v }
+}
+
+// OnError sets the handler of rejected messages(default: ignore).
+func OnError(handler func(m Message, e error)) BridgeOption {
+	return func(b *Bridge) { b.onErr = handler }
+}
+
+// WithBatchSize limits the number of samples written by a BatchSet call(default: 1024).
+// The limit of the batch setter must be sp.BatchesPerSample times the size or more.
+func WithBatchSize(n int) BridgeOption {
+	return func(b *Bridge) { b.batchSize = n }
+}
+
+func BridgeNew(sub Subscriber, pattern TopicPattern, decode PayloadDecoder, bset sp.BatchSet, opts ...BridgeOption) *Bridge {
+	b := &Bridge{
+		sub:       sub,
+		pattern:   pattern,
+		decode:    decode,
+		bset:      bset,
+		batchSize: defaultBatchSize,
+		validate:  sp.DefaultIdValidator,
+		onErr:     func(_ Message, _ error) {},
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.bset = sp.ChunkedBatchSet(b.bset, b.batchSize)
+	return b
+}
+
+// Handle writes the message.
+func (b *Bridge) Handle(ctx context.Context, m Message) error {
+	id, ok := b.pattern.Match(m.Topic)
+	if !ok {
+		return fmt.Errorf("Unexpected topic: %s", m.Topic)
+	}
+	e := b.validate(id)
+	if nil != e {
+		return e
+	}
+	if m.Received.IsZero() {
+		m.Received = b.now()
+	}
+	samples, e := b.decode(id, m)
+	if nil != e {
+		return e
+	}
+	return b.bset(ctx, s2k.IterFromArray(samples))
+}
+
+// Run subscribes the topics until the context is done.
+// Errors of messages are passed to the error handler(the subscription continues).
+func (b *Bridge) Run(ctx context.Context) error {
+	return b.sub.Subscribe(ctx, b.pattern.Filter(), func(ctx context.Context, m Message) error {
+		e := b.Handle(ctx, m)
+		if nil != e {
+			b.onErr(m, e)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,216 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	tskey "github.com/takanoriyanagitani/go-spacetimedb/key"
+	vlcb "github.com/takanoriyanagitani/go-spacetimedb/vlog/cbor"
+)
+
+func checker[T comparable](t *testing.T, got T, expected T) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("Unexpected value got.\n")
+		t.Errorf("expected: %v\n", expected)
+		t.Errorf("got:      %v\n", got)
+	}
+}
+
+type setRecorder struct {
+	lk      sync.Mutex
+	samples []vlcb.SampleDto
+}
+
+func (r *setRecorder) Set(_ context.Context, id string, date time.Time, key, val []byte) error {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.samples = append(r.samples, vlcb.SampleDto{Id: id, Date: date, Key: key, Val: val})
+	return nil
+}
+
+func TestTopicPattern(t *testing.T) {
+	t.Parallel()
+
+	p, e := TopicPatternNew("site/{id}/telemetry")
+	if nil != e {
+		t.Fatalf("Invalid pattern: %v", e)
+	}
+	checker(t, p.Filter(), "site/+/telemetry")
+
+	id, ok := p.Match("site/cafef00d/telemetry")
+	checker(t, ok, true)
+	checker(t, id, "cafef00d")
+
+	for _, topic := range []string{"site/cafef00d", "site/cafef00d/telemetry/x", "home/cafef00d/telemetry", "site//telemetry"} {
+		_, ok = p.Match(topic)
+		checker(t, ok, false)
+	}
+
+	p, e = TopicPatternNew("+/{id}/#")
+	if nil != e {
+		t.Fatalf("Invalid pattern: %v", e)
+	}
+	id, ok = p.Match("site/cafef00d/telemetry/cpu")
+	checker(t, ok, true)
+	checker(t, id, "cafef00d")
+	checker(t, MatchFilter(p.Filter(), "site/cafef00d/telemetry/cpu"), true)
+	checker(t, MatchFilter("site/+/telemetry", "site/cafef00d/status"), false)
+
+	for _, pattern := range []string{"site/+/telemetry", "{id}/{id}", "#/{id}"} {
+		_, e = TopicPatternNew(pattern)
+		if nil == e {
+			t.Errorf("Must fail: %s", pattern)
+		}
+	}
+}
+
+func TestBridge(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 0, time.UTC)
+	pattern, _ := TopicPatternNew("site/{id}/telemetry")
+
+	run := func(t *testing.T, b *Bridge, mem *MemSubscriber) (stop func()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- b.Run(ctx) }()
+		for 0 == mem.Subscribers() {
+			time.Sleep(time.Millisecond)
+		}
+		return func() {
+			cancel()
+			checker(t, errors.Is(<-done, context.Canceled), true)
+		}
+	}
+
+	t.Run("vlog", func(t *testing.T) {
+		t.Parallel()
+
+		var r setRecorder
+		var rejected []error
+		mem := MemSubscriberNew()
+		b := BridgeNew(mem, pattern, VlogDecoder(vlcb.CborVlogNew()), FromSet(r.Set), OnError(func(_ Message, e error) {
+			rejected = append(rejected, e)
+		}))
+		stop := run(t, b, mem)
+
+		packed, _ := vlcb.CborVlogNew().Pack([]sp.TsSample{
+			sp.TsSampleNew("", dt, []byte("k0"), []byte("v0")),
+			sp.TsSampleNew("cafef00d", dt, []byte("k1"), []byte("v1")),
+		})
+		e := mem.Publish(context.Background(), "site/cafef00d/telemetry", packed)
+		if nil != e {
+			t.Fatalf("Unable to publish: %v", e)
+		}
+
+		spoofed, _ := vlcb.CborVlogNew().Pack([]sp.TsSample{sp.TsSampleNew("deadbeaf", dt, nil, nil)})
+		_ = mem.Publish(context.Background(), "site/cafef00d/telemetry", spoofed)
+		_ = mem.Publish(context.Background(), "site/cafef00d/status", packed) // not subscribed
+		stop()
+
+		checker(t, len(r.samples), 2)
+		checker(t, r.samples[0].Id, "cafef00d")
+		checker(t, string(r.samples[1].Val), "v1")
+		checker(t, len(rejected), 1)
+	})
+
+	t.Run("raw", func(t *testing.T) {
+		t.Parallel()
+
+		var r setRecorder
+		mem := MemSubscriberNew()
+		b := BridgeNew(mem, pattern, RawDecoder, FromSet(r.Set), WithIdValidator(func(id string) error {
+			if "cafef00d" != id {
+				return fmt.Errorf("Unknown device: %s", id)
+			}
+			return nil
+		}))
+		stop := run(t, b, mem)
+
+		_ = mem.Publish(context.Background(), "site/cafef00d/telemetry", []byte(`{"temp":21.5}`))
+		_ = mem.Publish(context.Background(), "site/deadbeaf/telemetry", []byte(`{"temp":0}`))
+		stop()
+
+		checker(t, len(r.samples), 1)
+		checker(t, string(r.samples[0].Val), `{"temp":21.5}`)
+		tm, e := tskey.TimeDecode(r.samples[0].Key)
+		if nil != e {
+			t.Fatalf("Invalid key: %v", e)
+		}
+		checker(t, tm.Equal(r.samples[0].Date), true)
+	})
+
+	t.Run("Handle", func(t *testing.T) {
+		t.Parallel()
+
+		var r setRecorder
+		b := BridgeNew(MemSubscriberNew(), pattern, RawDecoder, FromSet(r.Set))
+		e := b.Handle(context.Background(), Message{Topic: "site/cafef00d/telemetry", Received: dt})
+		if nil != e {
+			t.Fatalf("Unable to handle: %v", e)
+		}
+		checker(t, r.samples[0].Date, dt)
+
+		e = b.Handle(context.Background(), Message{Topic: "unknown"})
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+
+		e = b.Handle(context.Background(), Message{Topic: "site/DROP TABLE/telemetry", Received: dt})
+		if nil == e {
+			t.Errorf("Must fail(default id validator)")
+		}
+	})
+
+	t.Run("batch size", func(t *testing.T) {
+		t.Parallel()
+
+		var writes int
+		var r setRecorder
+		var bset sp.BatchSet = FromSet(r.Set)
+		packed, e := vlcb.CborVlogNew().Pack([]sp.TsSample{
+			sp.TsSampleNew("cafef00d", dt, []byte("k0"), nil),
+			sp.TsSampleNew("cafef00d", dt, []byte("k1"), nil),
+			sp.TsSampleNew("cafef00d", dt, []byte("k2"), nil),
+		})
+		if nil != e {
+			t.Fatalf("Unable to pack: %v", e)
+		}
+		b := BridgeNew(MemSubscriberNew(), pattern, VlogDecoder(vlcb.CborVlogNew()), func(ctx context.Context, many s2k.Iter[sp.TsSample]) error {
+			writes += 1
+			return bset(ctx, many)
+		}, WithBatchSize(2))
+		e = b.Handle(context.Background(), Message{Topic: "site/cafef00d/telemetry", Payload: packed, Received: dt})
+		if nil != e {
+			t.Fatalf("Unable to handle: %v", e)
+		}
+		checker(t, len(r.samples), 3)
+		checker(t, writes, 2)
+	})
+
+	t.Run("unsubscribed while publishing", func(t *testing.T) {
+		t.Parallel()
+
+		mem := MemSubscriberNew()
+		sub := &memSubscription{filter: "site/+/telemetry", ch: make(chan delivery), done: make(chan struct{})}
+		close(sub.done) // the subscriber returned after Publish found the subscription
+		mem.subs[sub] = struct{}{}
+
+		published := make(chan error, 1)
+		go func() { published <- mem.Publish(context.Background(), "site/cafef00d/telemetry", nil) }()
+		select {
+		case e := <-published:
+			checker(t, e, nil)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Publish blocked")
+		}
+	})
+}
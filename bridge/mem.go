@@ -0,0 +1,91 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type delivery struct {
+	m    Message
+	done chan error
+}
+
+type memSubscription struct {
+	filter string
+	ch     chan delivery
+	done   chan struct{} // closed after unsubscribed
+}
+
+// MemSubscriber is an in-memory broker.
+type MemSubscriber struct {
+	lk   sync.Mutex
+	subs map[*memSubscription]struct{}
+}
+
+func MemSubscriberNew() *MemSubscriber {
+	return &MemSubscriber{subs: make(map[*memSubscription]struct{})}
+}
+
+func (m *MemSubscriber) Subscribe(ctx context.Context, filter string, handler func(ctx context.Context, m Message) error) error {
+	sub := &memSubscription{filter: filter, ch: make(chan delivery), done: make(chan struct{})}
+	m.lk.Lock()
+	m.subs[sub] = struct{}{}
+	m.lk.Unlock()
+	defer func() {
+		m.lk.Lock()
+		delete(m.subs, sub)
+		m.lk.Unlock()
+		close(sub.done)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d := <-sub.ch:
+			d.done <- handler(ctx, d.m)
+		}
+	}
+}
+
+// Subscribers gets the number of active subscriptions.
+func (m *MemSubscriber) Subscribers() int {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	return len(m.subs)
+}
+
+// Publish delivers the message to matching subscriptions and waits for the handlers.
+// Messages without subscriptions(including ones unsubscribed while publishing) are dropped.
+func (m *MemSubscriber) Publish(ctx context.Context, topic string, payload []byte) error {
+	m.lk.Lock()
+	var matched []*memSubscription
+	for sub := range m.subs {
+		if MatchFilter(sub.filter, topic) {
+			matched = append(matched, sub)
+		}
+	}
+	m.lk.Unlock()
+
+	var msg Message = Message{Topic: topic, Payload: payload, Received: time.Now()}
+	for _, sub := range matched {
+		d := delivery{m: msg, done: make(chan error, 1)}
+		select {
+		case sub.ch <- d:
+		case <-sub.done:
+			continue
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case e := <-d.done:
+			if nil != e {
+				return e
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
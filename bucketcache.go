@@ -0,0 +1,220 @@
+package stdb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+// BucketCacheStats counts lookups of a BucketCache.
+type BucketCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64 // removed by the size limit
+	Expired   uint64 // removed by the TTL
+}
+
+// BucketCache remembers created buckets to skip redundant AddBucket calls.
+//
+// Size and TTL are unlimited by default.
+// Buckets dropped elsewhere must be invalidated(see Invalidate and InvalidatingDelBucketNew).
+type BucketCache struct {
+	lk      sync.Mutex
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	buckets *lru
+	stats   BucketCacheStats
+}
+
+type BucketCacheOption func(c *BucketCache)
+
+// BucketCacheSize limits the number of buckets(least recently used buckets will be evicted).
+func BucketCacheSize(size int) BucketCacheOption {
+	return func(c *BucketCache) { c.size = size }
+}
+
+// BucketCacheTTL forgets buckets created before the ttl.
+func BucketCacheTTL(ttl time.Duration) BucketCacheOption {
+	return func(c *BucketCache) { c.ttl = ttl }
+}
+
+func bucketCacheClock(now func() time.Time) BucketCacheOption {
+	return func(c *BucketCache) { c.now = now }
+}
+
+func BucketCacheNew(opts ...BucketCacheOption) *BucketCache {
+	c := &BucketCache{now: time.Now}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.buckets = lruNew(c.size)
+	return c
+}
+
+func (c *BucketCache) expired(created time.Time) bool {
+	return 0 < c.ttl && c.ttl <= c.now().Sub(created)
+}
+
+func (c *BucketCache) Has(bucket string) bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	created, found := c.buckets.peek(bucket)
+	if !found {
+		c.stats.Misses += 1
+		return false
+	}
+	if c.expired(created) {
+		c.buckets.remove(bucket)
+		c.stats.Expired += 1
+		c.stats.Misses += 1
+		return false
+	}
+	c.buckets.touch(bucket)
+	c.stats.Hits += 1
+	return true
+}
+
+// peek checks the bucket without updating the order and the stats.
+func (c *BucketCache) peek(bucket string) bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	created, found := c.buckets.peek(bucket)
+	return found && !c.expired(created)
+}
+
+func (c *BucketCache) Add(bucket string) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.stats.Evictions += uint64(c.buckets.add(bucket, c.now()))
+}
+
+// Invalidate forgets the bucket. Use this after dropping the bucket.
+func (c *BucketCache) Invalidate(bucket string) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.buckets.remove(bucket)
+}
+
+// InvalidateIf forgets buckets which match the filter(e.g. buckets removed by a retention job).
+func (c *BucketCache) InvalidateIf(filter func(bucket string) bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.buckets.removeIf(filter)
+}
+
+// InvalidatePrefix forgets buckets which start with the prefix(e.g. data_20220826_).
+func (c *BucketCache) InvalidatePrefix(prefix string) {
+	c.InvalidateIf(func(bucket string) bool { return strings.HasPrefix(bucket, prefix) })
+}
+
+// Purge forgets all buckets. Stats are kept.
+func (c *BucketCache) Purge() {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.buckets.purge()
+}
+
+func (c *BucketCache) Len() int {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.buckets.len()
+}
+
+func (c *BucketCache) Stats() BucketCacheStats {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.stats
+}
+
+type bucketCall struct {
+	done chan struct{}
+	err  error
+}
+
+// errAdderPanicked is reported to waiting calls if the original adder panics.
+var errAdderPanicked = errors.New("Unable to add the bucket: adder panicked")
+
+// AsAdder creates an adder which calls the original adder only for buckets missing in the cache.
+// Concurrent calls for the same bucket are coalesced(only one call reaches the original adder).
+// Waiting calls get the result of the first call.
+// If the first call was canceled by its context, waiting calls retry using their own contexts.
+func (c *BucketCache) AsAdder(adder s2k.AddBucket) s2k.AddBucket {
+	var lk sync.Mutex
+	inflight := make(map[string]*bucketCall)
+
+	create := func(ctx context.Context, bucket string, call *bucketCall) {
+		call.err = errAdderPanicked // overwritten unless the adder panics
+		defer func() {
+			lk.Lock()
+			delete(inflight, bucket)
+			lk.Unlock()
+			close(call.done)
+		}()
+		call.err = adder(ctx, bucket)
+		if nil == call.err {
+			c.Add(bucket)
+		}
+	}
+
+	canceled := func(e error) bool {
+		return errors.Is(e, context.Canceled) || errors.Is(e, context.DeadlineExceeded)
+	}
+
+	return func(ctx context.Context, bucket string) error {
+		for {
+			if c.Has(bucket) {
+				return nil
+			}
+
+			lk.Lock()
+			if c.peek(bucket) {
+				// created by a call finished after the Has
+				lk.Unlock()
+				return nil
+			}
+			call, found := inflight[bucket]
+			if !found {
+				call = &bucketCall{done: make(chan struct{})}
+				inflight[bucket] = call
+			}
+			lk.Unlock()
+
+			if !found {
+				create(ctx, bucket, call)
+				return call.err
+			}
+
+			select {
+			case <-call.done:
+				if canceled(call.err) && nil == ctx.Err() {
+					continue // the first call was canceled
+				}
+				return call.err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// AsDelBucket creates a dropper which invalidates the bucket.
+func (c *BucketCache) AsDelBucket(del s2k.DelBucket) s2k.DelBucket {
+	return InvalidatingDelBucketNew(del, c.Invalidate)
+}
+
+// InvalidatingDelBucketNew creates a dropper which calls hooks after the drop.
+// Hooks are called even if the drop fails(the bucket may be partially dropped).
+func InvalidatingDelBucketNew(del s2k.DelBucket, hooks ...func(bucket string)) s2k.DelBucket {
+	return func(ctx context.Context, bucket string) error {
+		e := del(ctx, bucket)
+		for _, hook := range hooks {
+			hook(bucket)
+		}
+		return e
+	}
+}
@@ -0,0 +1,294 @@
+package stdb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+type countingAdder struct{ calls map[string]int }
+
+func (a *countingAdder) AddBucket(_ context.Context, bucket string) error {
+	a.calls[bucket] += 1
+	return nil
+}
+
+func TestBucketCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("hits and misses", func(t *testing.T) {
+		t.Parallel()
+
+		a := countingAdder{calls: make(map[string]int)}
+		var c *BucketCache = BucketCacheNew()
+		var adder s2k.AddBucket = c.AsAdder(a.AddBucket)
+
+		_ = adder(ctx, "devices")
+		_ = adder(ctx, "devices")
+		_ = adder(ctx, "dates")
+
+		checker(1, a.calls["devices"], t)
+		checker(BucketCacheStats{Hits: 1, Misses: 2}, c.Stats(), t)
+	})
+
+	t.Run("size", func(t *testing.T) {
+		t.Parallel()
+
+		a := countingAdder{calls: make(map[string]int)}
+		var c *BucketCache = BucketCacheNew(BucketCacheSize(2))
+		var adder s2k.AddBucket = c.AsAdder(a.AddBucket)
+
+		_ = adder(ctx, "data_20220826_a")
+		_ = adder(ctx, "data_20220826_b")
+		_ = adder(ctx, "data_20220826_a") // b is the least recently used
+		_ = adder(ctx, "data_20220827_a")
+		_ = adder(ctx, "data_20220826_b")
+
+		checker(2, c.Len(), t)
+		checker(1, a.calls["data_20220826_a"], t)
+		checker(2, a.calls["data_20220826_b"], t)
+		checker(uint64(2), c.Stats().Evictions, t)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		t.Parallel()
+
+		var now time.Time = time.Date(2022, time.August, 26, 0, 0, 0, 0, time.UTC)
+		a := countingAdder{calls: make(map[string]int)}
+		var c *BucketCache = BucketCacheNew(
+			BucketCacheTTL(time.Hour),
+			bucketCacheClock(func() time.Time { return now }),
+		)
+		var adder s2k.AddBucket = c.AsAdder(a.AddBucket)
+
+		_ = adder(ctx, "devices")
+		now = now.Add(59 * time.Minute)
+		_ = adder(ctx, "devices")
+		checker(1, a.calls["devices"], t)
+
+		now = now.Add(time.Minute)
+		_ = adder(ctx, "devices")
+		checker(2, a.calls["devices"], t)
+		checker(uint64(1), c.Stats().Expired, t)
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		t.Parallel()
+
+		a := countingAdder{calls: make(map[string]int)}
+		var c *BucketCache = BucketCacheNew()
+		var adder s2k.AddBucket = c.AsAdder(a.AddBucket)
+		var del s2k.DelBucket = c.AsDelBucket(func(_ context.Context, _ string) error {
+			return fmt.Errorf("partially dropped")
+		})
+
+		_ = adder(ctx, "data_20220826_a")
+		_ = adder(ctx, "data_20220826_b")
+		_ = adder(ctx, "data_20220827_a")
+		_ = adder(ctx, "devices_20220826")
+
+		if nil == del(ctx, "devices_20220826") {
+			t.Fatalf("Must fail")
+		}
+		checker(3, c.Len(), t)
+
+		c.InvalidatePrefix("data_20220826_")
+		checker(1, c.Len(), t)
+
+		_ = adder(ctx, "data_20220826_a")
+		checker(2, a.calls["data_20220826_a"], t)
+
+		c.Purge()
+		checker(0, c.Len(), t)
+	})
+
+	t.Run("adder error", func(t *testing.T) {
+		t.Parallel()
+
+		var c *BucketCache = BucketCacheNew()
+		var adder s2k.AddBucket = c.AsAdder(func(_ context.Context, _ string) error {
+			return fmt.Errorf("Must fail")
+		})
+		if nil == adder(ctx, "devices") {
+			t.Fatalf("Must fail")
+		}
+		checker(0, c.Len(), t)
+	})
+
+	t.Run("IndexCache", func(t *testing.T) {
+		t.Parallel()
+
+		var ic *IndexCache = IndexCacheNew(16)
+		var del s2k.DelBucket = InvalidatingDelBucketNew(
+			func(_ context.Context, _ string) error { return nil },
+			ic.InvalidateBucket,
+		)
+		ic.Add("devices_20220826\x00a")
+		ic.Add("devices_20220826\x00b")
+		ic.Add("devices_202208260\x00a")
+
+		e := del(ctx, "devices_20220826")
+		if nil != e {
+			t.Fatalf("Unable to drop: %v", e)
+		}
+		checker(1, ic.Len(), t)
+	})
+}
+
+func TestBucketCacheConcurrent(t *testing.T) {
+	t.Parallel()
+
+	const writers = 256
+	const buckets = 4
+
+	var lk sync.Mutex
+	calls := make(map[string]int)
+	var adder s2k.AddBucket = BucketCacheNew().AsAdder(func(_ context.Context, bucket string) error {
+		time.Sleep(10 * time.Millisecond) // slow CREATE TABLE
+		lk.Lock()
+		defer lk.Unlock()
+		calls[bucket] += 1
+		return nil
+	})
+
+	var start sync.WaitGroup
+	var done sync.WaitGroup
+	start.Add(1)
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			start.Wait()
+			errs <- adder(context.Background(), fmt.Sprintf("data_20220826_%d", i%buckets))
+		}(i)
+	}
+	start.Done()
+	done.Wait()
+	close(errs)
+
+	for e := range errs {
+		if nil != e {
+			t.Fatalf("Unable to create: %v", e)
+		}
+	}
+	checker(buckets, len(calls), t)
+	for bucket, n := range calls {
+		if 1 != n {
+			t.Errorf("Unexpected number of calls(%s): %v", bucket, n)
+		}
+	}
+}
+
+func TestBucketCacheConcurrentError(t *testing.T) {
+	t.Parallel()
+
+	var lk sync.Mutex
+	var calls int = 0
+	var adder s2k.AddBucket = BucketCacheNew().AsAdder(func(_ context.Context, _ string) error {
+		time.Sleep(10 * time.Millisecond)
+		lk.Lock()
+		defer lk.Unlock()
+		calls += 1
+		return fmt.Errorf("Must fail")
+	})
+
+	var wg sync.WaitGroup
+	var failed int32 = 0
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if nil != adder(context.Background(), "devices") {
+				atomic.AddInt32(&failed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	checker(int32(16), failed, t)
+	if 16 <= calls {
+		t.Errorf("Concurrent calls not coalesced: %v", calls)
+	}
+
+	// failures are not cached
+	e := adder(context.Background(), "devices")
+	if nil == e {
+		t.Errorf("Must fail")
+	}
+}
+
+func TestBucketCacheCanceledLeader(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	var calls int32 = 0
+	var adder s2k.AddBucket = BucketCacheNew().AsAdder(func(ctx context.Context, _ string) error {
+		if 1 == atomic.AddInt32(&calls, 1) {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() { leader <- adder(ctx, "devices") }()
+	<-started
+
+	waiter := make(chan error, 1)
+	go func() { waiter <- adder(context.Background(), "devices") }()
+	time.Sleep(10 * time.Millisecond) // waits the leader
+	cancel()
+
+	if nil == <-leader {
+		t.Errorf("Must fail")
+	}
+	e := <-waiter
+	if nil != e {
+		t.Errorf("Waiting call must retry: %v", e)
+	}
+}
+
+func TestBucketCachePanic(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls int32 = 0
+	var adder s2k.AddBucket = BucketCacheNew().AsAdder(func(_ context.Context, _ string) error {
+		if 1 != atomic.AddInt32(&calls, 1) {
+			return fmt.Errorf("Must fail")
+		}
+		close(started)
+		<-release
+		panic("broken driver")
+	})
+
+	go func() {
+		defer func() { _ = recover() }()
+		_ = adder(context.Background(), "devices")
+	}()
+	<-started
+
+	waiter := make(chan error, 1)
+	go func() { waiter <- adder(context.Background(), "devices") }()
+	time.Sleep(10 * time.Millisecond) // waits the leader
+	close(release)
+
+	select {
+	case e := <-waiter:
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Waiting call blocked")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	// use pgx driver to connect to postgres
+	_ "github.com/jackc/pgx/v4/stdlib"
+
+	// use mattn driver to connect to sqlite
+	_ "github.com/mattn/go-sqlite3"
+
+	// use postgres driver to generate sql
+	_ "github.com/takanoriyanagitani/go-sql2keyval/pkg/sqldb/postgres"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+	std "github.com/takanoriyanagitani/go-sql2keyval/pkg/stdsql"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+)
+
+func init() {
+	s2k.RegisterQueryGenerator("sqlite3", sqliteQueryGenerator{})
+}
+
+var sqliteTable = regexp.MustCompile(`^[a-z][0-9a-z_]{0,62}$`)
+
+// sqliteQueryGenerator creates a table(key BLOB, val BLOB) for each bucket.
+type sqliteQueryGenerator struct{}
+
+func (g sqliteQueryGenerator) generate(bucket string, format string) (string, error) {
+	if !sqliteTable.MatchString(bucket) {
+		return "", fmt.Errorf("Invalid bucket name: %s", bucket)
+	}
+	return fmt.Sprintf(format, bucket), nil
+}
+
+func (g sqliteQueryGenerator) Get(bucket string) (string, error) {
+	return g.generate(bucket, `SELECT val FROM %s WHERE key=? LIMIT 1`)
+}
+
+func (g sqliteQueryGenerator) Del(bucket string) (string, error) {
+	return g.generate(bucket, `DELETE FROM %s WHERE key=?`)
+}
+
+func (g sqliteQueryGenerator) Add(bucket string) (string, error) {
+	return g.generate(bucket, `INSERT INTO %s(key, val) VALUES (?, ?)`)
+}
+
+func (g sqliteQueryGenerator) Set(bucket string) (string, error) {
+	return g.generate(bucket, `
+		INSERT INTO %s(key, val) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET val=excluded.val
+		WHERE val != excluded.val
+	`)
+}
+
+func (g sqliteQueryGenerator) Lst(bucket string) (string, error) {
+	return g.generate(bucket, `SELECT key FROM %s ORDER BY key`)
+}
+
+func (g sqliteQueryGenerator) DelBucket(bucket string) (string, error) {
+	return g.generate(bucket, `DROP TABLE IF EXISTS %s`)
+}
+
+func (g sqliteQueryGenerator) AddBucket(bucket string) (string, error) {
+	return g.generate(bucket, `CREATE TABLE IF NOT EXISTS %s(key BLOB PRIMARY KEY, val BLOB NOT NULL)`)
+}
+
+// backend: sql driver name, query generator name
+var backends = map[string][2]string{
+	"postgres": {"pgx", "postgres"},
+	"sqlite":   {"sqlite3", "sqlite3"},
+}
+
+type store struct {
+	db        *sql.DB
+	gen       string
+	lst       s2k.Lst
+	get       s2k.Get
+	fastAdder s2k.AddBucket
+}
+
+func storeOpen(backend string, conn string) (*store, error) {
+	names, ok := backends[backend]
+	if !ok {
+		return nil, fmt.Errorf("Unknown driver: %s", backend)
+	}
+	db, e := std.DbOpenNew(names[0])(conn)
+	if nil != e {
+		return nil, e
+	}
+	if "sqlite" == backend {
+		db.SetMaxOpenConns(1) // avoid SQLITE_BUSY
+	}
+	return &store{
+		db:        db,
+		gen:       names[1],
+		lst:       s2k.LstFactory(names[1])(std.QueryCbNew(db)),
+		get:       s2k.GetFactory(names[1])(std.QueryNew(db)),
+		fastAdder: sp.FastBucketAdderNew(s2k.AddBucketFactory(names[1])(std.ExecNew(db))),
+	}, nil
+}
+
+func (s *store) Close() error { return s.db.Close() }
+
+// setBatch creates the buckets and then upserts all pairs in a transaction.
+func (s *store) setBatch(ctx context.Context, many s2k.Iter[s2k.Batch]) error {
+	var batches []s2k.Batch = many.ToArray()
+
+	tx, e := s.db.BeginTx(ctx, nil)
+	if nil != e {
+		return e
+	}
+	var set s2k.Set = s2k.SetFactory(s.gen)(func(ctx context.Context, query string, args ...any) error {
+		_, e := tx.ExecContext(ctx, query, args...)
+		return e
+	})
+	for _, b := range batches {
+		var p s2k.Pair = b.Pair()
+		e = set(ctx, b.Bucket(), p.Key, p.Val)
+		if nil != e {
+			_ = tx.Rollback()
+			return fmt.Errorf("Unable to set(bucket: %s): %v", b.Bucket(), e)
+		}
+	}
+	return tx.Commit()
+}
+
+// batchSetter creates a BatchSet which accepts at most n samples per call.
+func (s *store) batchSetter(p sp.Partitioner, n int) sp.BatchSet {
+	return sp.NewBatchSetter(s.fastAdder, s.setBatch, sp.BatchesPerSample*n)(p.Label)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fxamacker/cbor/v2"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	tscsv "github.com/takanoriyanagitani/go-spacetimedb/csv"
+	vlcb "github.com/takanoriyanagitani/go-spacetimedb/vlog/cbor"
+)
+
+// sampleReader gets the next sample or io.EOF.
+type sampleReader func() (vlcb.SampleDto, error)
+
+// sampleWriter writes a sample; the writer is flushed by a nil sample.
+type sampleWriter func(s *vlcb.SampleDto) error
+
+// formatOf guesses the format using the extension of the file.
+func formatOf(name string) (string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".cbor", ".vlog":
+		return "cbor", nil
+	case ".jsonl", ".ndjson":
+		return "jsonl", nil
+	case ".csv":
+		return "csv", nil
+	}
+	return "", fmt.Errorf("Unable to guess the format of %s(use -format)", name)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, e := c.r.Read(p)
+	c.n += n
+	return n, e
+}
+
+// cborReaderNew reads samples packed by vlcb.
+// A truncated record at the end is reported as io.ErrUnexpectedEOF.
+func cborReaderNew(r io.Reader) sampleReader {
+	cr := &countingReader{r: r}
+	dec := cbor.NewDecoder(cr)
+	return func() (vlcb.SampleDto, error) {
+		s, e := vlcb.FromDecoder(dec)
+		if errors.Is(e, io.EOF) && dec.NumBytesRead() < cr.n {
+			return s, io.ErrUnexpectedEOF
+		}
+		return s, e
+	}
+}
+
+func jsonlReaderNew(r io.Reader) sampleReader {
+	dec := json.NewDecoder(r)
+	return func() (vlcb.SampleDto, error) {
+		var s sp.JsonSample
+		e := dec.Decode(&s)
+		return vlcb.SampleDto(s), e
+	}
+}
+
+func csvReaderNew(r io.Reader, opts ...tscsv.Option) sampleReader {
+	cr := tscsv.ReaderNew(r, opts...)
+	return func() (s vlcb.SampleDto, e error) {
+		t, e := cr.Read()
+		if nil != e {
+			return s, e
+		}
+		t.ForUser(&s)
+		return s, nil
+	}
+}
+
+func readerNew(format string, r io.Reader, csvOpts []tscsv.Option) (sampleReader, error) {
+	switch format {
+	case "cbor":
+		return cborReaderNew(r), nil
+	case "jsonl":
+		return jsonlReaderNew(r), nil
+	case "csv":
+		return csvReaderNew(r, csvOpts...), nil
+	}
+	return nil, fmt.Errorf("Unknown format: %s", format)
+}
+
+func cborWriterNew(w io.Writer) sampleWriter {
+	enc := cbor.NewEncoder(w)
+	return func(s *vlcb.SampleDto) error {
+		if nil == s {
+			return nil
+		}
+		return enc.Encode(s)
+	}
+}
+
+func jsonlWriterNew(w io.Writer) sampleWriter {
+	enc := json.NewEncoder(w)
+	return func(s *vlcb.SampleDto) error {
+		if nil == s {
+			return nil
+		}
+		return enc.Encode(sp.JsonSample(*s))
+	}
+}
+
+func csvWriterNew(w io.Writer, opts ...tscsv.Option) sampleWriter {
+	cw := tscsv.WriterNew(w, opts...)
+	return func(s *vlcb.SampleDto) error {
+		if nil == s {
+			return cw.Flush()
+		}
+		return cw.Write(s.ToSample())
+	}
+}
+
+// printable shows the bytes as a quoted string if possible.
+func printable(b []byte) string {
+	if utf8.Valid(b) && !strings.ContainsFunc(string(b), func(r rune) bool { return r < 0x20 || 0x7f == r }) {
+		return fmt.Sprintf("%q", b)
+	}
+	return "0x" + hex.EncodeToString(b)
+}
+
+// textWriterNew writes a line per sample for humans.
+func textWriterNew(w io.Writer) sampleWriter {
+	bw := bufio.NewWriter(w)
+	return func(s *vlcb.SampleDto) error {
+		if nil == s {
+			return bw.Flush()
+		}
+		_, e := fmt.Fprintf(
+			bw,
+			"%s\t%s\tkey=%s\tval=%s\n",
+			s.Id,
+			s.Date.Format(time.RFC3339Nano),
+			printable(s.Key),
+			printable(s.Val),
+		)
+		return e
+	}
+}
+
+func writerNew(format string, w io.Writer, csvOpts []tscsv.Option) (sampleWriter, error) {
+	switch format {
+	case "cbor":
+		return cborWriterNew(w), nil
+	case "jsonl":
+		return jsonlWriterNew(w), nil
+	case "csv":
+		return csvWriterNew(w, csvOpts...), nil
+	case "text":
+		return textWriterNew(w), nil
+	}
+	return nil, fmt.Errorf("Unknown format: %s", format)
+}
+
+// copySamples writes all samples and flushes the writer.
+func copySamples(w sampleWriter, r sampleReader) (n int, e error) {
+	for {
+		s, e := r()
+		if errors.Is(e, io.EOF) {
+			return n, w(nil)
+		}
+		if nil != e {
+			return n, fmt.Errorf("Invalid sample(#%d): %v", n, e)
+		}
+		e = w(&s)
+		if nil != e {
+			return n, e
+		}
+		n += 1
+	}
+}
+
+func toSamples(dtos []vlcb.SampleDto) []sp.TsSample {
+	samples := make([]sp.TsSample, 0, len(dtos))
+	for i := range dtos {
+		samples = append(samples, dtos[i].ToSample())
+	}
+	return samples
+}
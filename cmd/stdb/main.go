@@ -0,0 +1,456 @@
+// Command stdb imports, exports and inspects samples.
+//
+//	stdb import -driver sqlite -db ./stdb.db samples.jsonl samples.cbor
+//	stdb export -driver sqlite -db ./stdb.db -id cafef00d -start 2022-08-26T00:00:00Z -end 2022-08-27T00:00:00Z
+//	stdb list   -driver sqlite -db ./stdb.db devices
+//	stdb decode samples.cbor
+//	stdb inspect -repair repaired.cbor upload.cbor
+//
+// Samples are stored in the buckets of the partitions(-partition) using NewBatchSetter.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	tscsv "github.com/takanoriyanagitani/go-spacetimedb/csv"
+	vlcb "github.com/takanoriyanagitani/go-spacetimedb/vlog/cbor"
+)
+
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	summary string
+	run     func(ctx context.Context, env env, args []string) error
+}
+
+var commands = map[string]command{
+	"import":  {"import cbor(vlog)/jsonl/csv files", runImport},
+	"export":  {"export samples of a device in [start, end)", runExport},
+	"list":    {"list devices/dates using the index buckets", runList},
+	"decode":  {"print samples of cbor(vlog) files", runDecode},
+	"inspect": {"print records(offset, size, id, date, key/val size) of a cbor(vlog) file", runInspect},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: stdb <command> [flags] [args]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-8s %s\n", name, commands[name].summary)
+	}
+}
+
+func run(ctx context.Context, env env, args []string) error {
+	if 0 == len(args) {
+		usage(env.stderr)
+		return flag.ErrHelp
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		usage(env.stderr)
+		return fmt.Errorf("Unknown command: %s", args[0])
+	}
+	return cmd.run(ctx, env, args[1:])
+}
+
+type dbFlags struct {
+	driver    *string
+	conn      *string
+	partition *string
+}
+
+func flagSetNew(name string, env env) *flag.FlagSet {
+	fs := flag.NewFlagSet("stdb "+name, flag.ContinueOnError)
+	fs.SetOutput(env.stderr)
+	return fs
+}
+
+func dbFlagsNew(fs *flag.FlagSet) dbFlags {
+	return dbFlags{
+		driver:    fs.String("driver", "sqlite", "postgres or sqlite"),
+		conn:      fs.String("db", "", "connection string(postgres: dsn, sqlite: file name)"),
+		partition: fs.String("partition", "day", "hour, day, week, month or year"),
+	}
+}
+
+func (d dbFlags) open() (*store, sp.Partitioner, error) {
+	p, e := sp.DefaultPartitioners.Get(*d.partition)
+	if nil != e {
+		return nil, nil, e
+	}
+	if "" == *d.conn {
+		return nil, nil, fmt.Errorf("-db required")
+	}
+	s, e := storeOpen(*d.driver, *d.conn)
+	return s, p, e
+}
+
+type csvFlags struct {
+	key *string
+	val *string
+}
+
+func csvFlagsNew(fs *flag.FlagSet) csvFlags {
+	return csvFlags{
+		key: fs.String("csv-key", "base64", "encoding of csv keys(hex, base64 or text)"),
+		val: fs.String("csv-val", "base64", "encoding of csv values(hex, base64 or text)"),
+	}
+}
+
+func (c csvFlags) options() ([]tscsv.Option, error) {
+	key, e := tscsv.EncodingOf(*c.key)
+	if nil != e {
+		return nil, e
+	}
+	val, e := tscsv.EncodingOf(*c.val)
+	if nil != e {
+		return nil, e
+	}
+	return []tscsv.Option{tscsv.KeyEncoding(key), tscsv.ValEncoding(val)}, nil
+}
+
+// openInput opens the file or stdin(-).
+func openInput(env env, name string) (io.ReadCloser, error) {
+	if "-" == name {
+		return io.NopCloser(env.stdin), nil
+	}
+	return os.Open(name)
+}
+
+// importSamples writes samples using the setter(at most n samples per call).
+func importSamples(ctx context.Context, bset sp.BatchSet, r sampleReader, n int) (total int, e error) {
+	var chunk []vlcb.SampleDto
+	flush := func() error {
+		if 0 == len(chunk) {
+			return nil
+		}
+		e := bset(ctx, s2k.IterFromArray(toSamples(chunk)))
+		if nil != e {
+			return e
+		}
+		total += len(chunk)
+		chunk = chunk[:0]
+		return nil
+	}
+	for {
+		s, e := r()
+		if errors.Is(e, io.EOF) {
+			return total, flush()
+		}
+		if nil != e {
+			return total, fmt.Errorf("Invalid sample(#%d): %v", total+len(chunk), e)
+		}
+		chunk = append(chunk, s)
+		if n <= len(chunk) {
+			e = flush()
+			if nil != e {
+				return total, e
+			}
+		}
+	}
+}
+
+func runImport(ctx context.Context, env env, args []string) error {
+	fs := flagSetNew("import", env)
+	db := dbFlagsNew(fs)
+	format := fs.String("format", "", "cbor, jsonl or csv(default: guessed using the extension)")
+	batch := fs.Int("batch", 1000, "samples per transaction")
+	csvf := csvFlagsNew(fs)
+	e := fs.Parse(args)
+	if nil != e {
+		return e
+	}
+	csvOpts, e := csvf.options()
+	if nil != e {
+		return e
+	}
+	if *batch < 1 {
+		return fmt.Errorf("Invalid batch size: %v", *batch)
+	}
+	s, p, e := db.open()
+	if nil != e {
+		return e
+	}
+	defer s.Close()
+
+	var bset sp.BatchSet = s.batchSetter(p, *batch)
+	var names []string = fs.Args()
+	if 0 == len(names) {
+		names = []string{"-"}
+	}
+	for _, name := range names {
+		var f string = *format
+		if "" == f {
+			f, e = formatOf(name)
+			if nil != e {
+				return e
+			}
+		}
+		e = importFile(ctx, env, bset, name, f, csvOpts, *batch)
+		if nil != e {
+			return fmt.Errorf("%s: %v", name, e)
+		}
+	}
+	return nil
+}
+
+func importFile(ctx context.Context, env env, bset sp.BatchSet, name, format string, csvOpts []tscsv.Option, batch int) error {
+	in, e := openInput(env, name)
+	if nil != e {
+		return e
+	}
+	defer in.Close()
+	r, e := readerNew(format, in, csvOpts)
+	if nil != e {
+		return e
+	}
+	n, e := importSamples(ctx, bset, r, batch)
+	fmt.Fprintf(env.stderr, "%s: %d samples imported\n", name, n)
+	return e
+}
+
+func parseTime(name, value string) (time.Time, error) {
+	t, e := time.Parse(time.RFC3339Nano, value)
+	if nil != e {
+		return t, fmt.Errorf("Invalid -%s(RFC3339 required): %v", name, e)
+	}
+	return t, nil
+}
+
+func runExport(ctx context.Context, env env, args []string) error {
+	fs := flagSetNew("export", env)
+	db := dbFlagsNew(fs)
+	id := fs.String("id", "", "device id")
+	start := fs.String("start", "", "start time(RFC3339, inclusive)")
+	end := fs.String("end", "", "end time(RFC3339, exclusive)")
+	format := fs.String("format", "jsonl", "cbor, jsonl, csv or text")
+	csvf := csvFlagsNew(fs)
+	e := fs.Parse(args)
+	if nil != e {
+		return e
+	}
+	csvOpts, e := csvf.options()
+	if nil != e {
+		return e
+	}
+	if "" == *id {
+		return fmt.Errorf("-id required")
+	}
+	lbi, e := parseTime("start", *start)
+	if nil != e {
+		return e
+	}
+	ube, e := parseTime("end", *end)
+	if nil != e {
+		return e
+	}
+	w, e := writerNew(*format, env.stdout, csvOpts)
+	if nil != e {
+		return e
+	}
+	s, p, e := db.open()
+	if nil != e {
+		return e
+	}
+	defer s.Close()
+
+	samples, e := sp.NewRangeReader(s.lst, s.get)(p)(ctx, *id, lbi, ube)
+	if nil != e {
+		return e
+	}
+	for o := samples(); o.HasValue(); o = samples() {
+		var dto vlcb.SampleDto
+		o.Value().ForUser(&dto)
+		e = w(&dto)
+		if nil != e {
+			return e
+		}
+	}
+	return w(nil)
+}
+
+func runList(ctx context.Context, env env, args []string) error {
+	fs := flagSetNew("list", env)
+	db := dbFlagsNew(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(env.stderr, "usage: stdb list [flags] devices | dates | dates-of <id> | devices-on <label>\n")
+		fs.PrintDefaults()
+	}
+	e := fs.Parse(args)
+	if nil != e {
+		return e
+	}
+	var rest []string = fs.Args()
+	if 0 == len(rest) {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	s, _, e := db.open()
+	if nil != e {
+		return e
+	}
+	defer s.Close()
+
+	var cat sp.Catalog = sp.CatalogNew(s.lst)
+	var items []string
+	switch {
+	case "devices" == rest[0] && 1 == len(rest):
+		items, e = cat.Devices(ctx)
+	case "dates" == rest[0] && 1 == len(rest):
+		items, e = cat.Dates(ctx)
+	case "dates-of" == rest[0] && 2 == len(rest):
+		items, e = cat.DatesOf(ctx, rest[1])
+	case "devices-on" == rest[0] && 2 == len(rest):
+		items, e = cat.DevicesOn(ctx, rest[1])
+	default:
+		fs.Usage()
+		return fmt.Errorf("Invalid args: %s", strings.Join(rest, " "))
+	}
+	if nil != e {
+		return e
+	}
+	for _, item := range items {
+		fmt.Fprintln(env.stdout, item)
+	}
+	return nil
+}
+
+func runDecode(ctx context.Context, env env, args []string) error {
+	fs := flagSetNew("decode", env)
+	format := fs.String("format", "text", "text, jsonl or csv")
+	csvf := csvFlagsNew(fs)
+	e := fs.Parse(args)
+	if nil != e {
+		return e
+	}
+	csvOpts, e := csvf.options()
+	if nil != e {
+		return e
+	}
+	var names []string = fs.Args()
+	if 0 == len(names) {
+		names = []string{"-"}
+	}
+	for _, name := range names {
+		e = decodeFile(env, name, *format, csvOpts)
+		if nil != e {
+			return fmt.Errorf("%s: %v", name, e)
+		}
+	}
+	return nil
+}
+
+func decodeFile(env env, name, format string, csvOpts []tscsv.Option) error {
+	in, e := openInput(env, name)
+	if nil != e {
+		return e
+	}
+	defer in.Close()
+	w, e := writerNew(format, env.stdout, csvOpts)
+	if nil != e {
+		return e
+	}
+	_, e = copySamples(w, cborReaderNew(in))
+	return e
+}
+
+// runInspect fails if malformed records are found(unless repaired).
+func runInspect(ctx context.Context, env env, args []string) error {
+	fs := flagSetNew("inspect", env)
+	repair := fs.String("repair", "", "write valid records to the file")
+	quiet := fs.Bool("quiet", false, "print malformed records only")
+	e := fs.Parse(args)
+	if nil != e {
+		return e
+	}
+	if 1 < fs.NArg() {
+		return fmt.Errorf("Too many files: %v", fs.NArg())
+	}
+	var name string = fs.Arg(0)
+	if "" == name {
+		name = "-"
+	}
+	in, e := openInput(env, name)
+	if nil != e {
+		return e
+	}
+	packed, e := io.ReadAll(in)
+	_ = in.Close()
+	if nil != e {
+		return e
+	}
+
+	var records, malformed int
+	bw := bufio.NewWriter(env.stdout)
+	fmt.Fprintf(bw, "offset\tsize\tid\tdate\tkey\tval\n")
+	e = vlcb.Walk(packed, func(r vlcb.Record) error {
+		records += 1
+		if !r.Valid() {
+			malformed += 1
+		}
+		if r.Valid() && *quiet {
+			return nil
+		}
+		_, e := fmt.Fprintln(bw, r)
+		return e
+	})
+	if nil != e {
+		return e
+	}
+	e = bw.Flush()
+	if nil != e {
+		return e
+	}
+	fmt.Fprintf(env.stderr, "%s: %d records, %d malformed\n", name, records, malformed)
+
+	if "" != *repair {
+		repaired, _ := vlcb.Repair(packed)
+		e = os.WriteFile(*repair, repaired, 0644)
+		if nil != e {
+			return e
+		}
+		fmt.Fprintf(env.stderr, "%s: %d records written\n", *repair, records-malformed)
+		return nil
+	}
+	if 0 < malformed {
+		return fmt.Errorf("%s: %d malformed records", name, malformed)
+	}
+	return nil
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	e := run(ctx, env{os.Stdin, os.Stdout, os.Stderr}, os.Args[1:])
+	switch {
+	case nil == e:
+	case errors.Is(e, flag.ErrHelp):
+		stop()
+		os.Exit(2)
+	default:
+		fmt.Fprintf(os.Stderr, "stdb: %v\n", e)
+		stop()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	vlcb "github.com/takanoriyanagitani/go-spacetimedb/vlog/cbor"
+)
+
+func checker[T comparable](t *testing.T, got T, expected T) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("Unexpected value got.\n")
+		t.Errorf("expected: %v\n", expected)
+		t.Errorf("got:      %v\n", got)
+	}
+}
+
+func stdb(t *testing.T, stdin string, args ...string) (stdout string, e error) {
+	t.Helper()
+	var out, errs bytes.Buffer
+	e = run(context.Background(), env{strings.NewReader(stdin), &out, &errs}, args)
+	return out.String(), e
+}
+
+func TestStdb(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 0, time.UTC)
+	var db string = filepath.Join(t.TempDir(), "stdb.db")
+
+	var jsonl bytes.Buffer
+	w := jsonlWriterNew(&jsonl)
+	for i, id := range []string{"cafef00d", "cafef00d", "deadbeaf"} {
+		s := vlcb.SampleDto{Id: id, Date: dt.Add(time.Duration(i) * 24 * time.Hour), Key: []byte{byte(i)}, Val: []byte("v")}
+		_ = w(&s)
+	}
+
+	_, e := stdb(t, jsonl.String(), "import", "-db", db, "-format", "jsonl", "-batch", "2")
+	if nil != e {
+		t.Fatalf("Unable to import: %v", e)
+	}
+
+	t.Run("list", func(t *testing.T) {
+		out, e := stdb(t, "", "list", "-db", db, "devices")
+		if nil != e {
+			t.Fatalf("Unable to list: %v", e)
+		}
+		checker(t, out, "cafef00d\ndeadbeaf\n")
+
+		out, _ = stdb(t, "", "list", "-db", db, "dates-of", "cafef00d")
+		checker(t, out, "20220826\n20220827\n")
+
+		out, _ = stdb(t, "", "list", "-db", db, "devices-on", "20220828")
+		checker(t, out, "deadbeaf\n")
+
+		_, e = stdb(t, "", "list", "-db", db, "unknown")
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+	})
+
+	t.Run("export", func(t *testing.T) {
+		out, e := stdb(
+			t, "",
+			"export", "-db", db, "-id", "cafef00d", "-format", "csv",
+			"-start", "2022-08-27T00:00:00Z", "-end", "2022-08-28T00:00:00Z",
+		)
+		if nil != e {
+			t.Fatalf("Unable to export: %v", e)
+		}
+		checker(t, out, "id,date,key,val\ncafef00d,2022-08-27T00:00:00Z,AQ==,dg==\n")
+
+		// csv -> cbor -> text
+		var packed bytes.Buffer
+		n, e := copySamples(cborWriterNew(&packed), csvReaderNew(strings.NewReader(out)))
+		if nil != e {
+			t.Fatalf("Unable to convert: %v", e)
+		}
+		checker(t, n, 1)
+		out, e = stdb(t, packed.String(), "decode")
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(t, out, "cafef00d\t2022-08-27T00:00:00Z\tkey=0x01\tval=\"v\"\n")
+
+		out, e = stdb(
+			t, "",
+			"export", "-db", db, "-id", "cafef00d", "-format", "csv", "-csv-key", "hex", "-csv-val", "text",
+			"-start", "2022-08-27T00:00:00Z", "-end", "2022-08-28T00:00:00Z",
+		)
+		if nil != e {
+			t.Fatalf("Unable to export: %v", e)
+		}
+		checker(t, out, "id,date,key,val\ncafef00d,2022-08-27T00:00:00Z,01,v\n")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, e := stdb(t, "", "export", "-db", db, "-id", "cafef00d", "-start", "yesterday", "-end", "today")
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+		_, e = stdb(t, "", "import", "-db", db, "samples.txt")
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+		_, e = stdb(t, "", "unknown")
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+	})
+}
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 0, time.UTC)
+	packed, _ := vlcb.CborVlogNew().Pack([]sp.TsSample{
+		sp.TsSampleNew("cafef00d", dt, []byte("k0"), []byte{0x00, 0xff}),
+	})
+
+	out, e := stdb(t, string(packed), "decode", "-format", "jsonl")
+	if nil != e {
+		t.Fatalf("Unable to decode: %v", e)
+	}
+	var s sp.JsonSample
+	e = json.Unmarshal([]byte(out), &s)
+	if nil != e {
+		t.Fatalf("Invalid json: %v", e)
+	}
+	checker(t, s.Id, "cafef00d")
+	checker(t, s.Date.Equal(dt), true)
+	checker(t, bytes.Equal(s.Val, []byte{0x00, 0xff}), true)
+
+	_, e = stdb(t, string(packed[:len(packed)-1]), "decode")
+	if nil == e {
+		t.Errorf("Must fail")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 0, time.UTC)
+	var buf bytes.Buffer
+	w := cborWriterNew(&buf)
+	_ = w(&vlcb.SampleDto{Id: "cafef00d", Date: dt, Key: []byte("k0"), Val: []byte("v0")})
+	var valid int = buf.Len()
+	buf.Write([]byte{0xff})
+	_ = w(&vlcb.SampleDto{Id: "cafef00d", Date: dt, Key: []byte("k1"), Val: []byte("v1")})
+	var packed []byte = buf.Bytes()
+
+	out, e := stdb(t, string(packed), "inspect", "-quiet")
+	if nil == e {
+		t.Errorf("Must fail")
+	}
+	checker(t, strings.Count(out, "\n"), 2)
+	checker(t, strings.HasPrefix(strings.Split(out, "\n")[1], fmt.Sprintf("%d\t1\tmalformed", valid)), true)
+
+	var repaired string = filepath.Join(t.TempDir(), "repaired.cbor")
+	_, e = stdb(t, string(packed), "inspect", "-repair", repaired)
+	if nil != e {
+		t.Fatalf("Unable to repair: %v", e)
+	}
+	out, e = stdb(t, "", "decode", repaired)
+	if nil != e {
+		t.Fatalf("Unable to decode: %v", e)
+	}
+	checker(t, strings.Count(out, "\n"), 2)
+}
@@ -0,0 +1,107 @@
+package stdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+type Encoder[T any] func(t T) ([]byte, error)
+type Decoder[T any] func(b []byte) (T, error)
+
+type Codec[T any] struct {
+	Encode Encoder[T]
+	Decode Decoder[T]
+}
+
+func CodecNew[T any](enc Encoder[T], dec Decoder[T]) Codec[T] {
+	return Codec[T]{
+		Encode: enc,
+		Decode: dec,
+	}
+}
+
+func fixed8Decoder[T any](name string, f func(u uint64) T) Decoder[T] {
+	return func(b []byte) (t T, e error) {
+		if 8 != len(b) {
+			return t, fmt.Errorf("Invalid %s(len=%v)", name, len(b))
+		}
+		return f(binary.BigEndian.Uint64(b)), nil
+	}
+}
+
+func fixed8Encoder[T any](f func(t T) uint64) Encoder[T] {
+	return func(t T) ([]byte, error) {
+		return binary.BigEndian.AppendUint64(nil, f(t)), nil
+	}
+}
+
+var BytesCodec Codec[[]byte] = CodecNew(
+	func(b []byte) ([]byte, error) { return b, nil },
+	func(b []byte) ([]byte, error) { return b, nil },
+)
+
+var StringCodec Codec[string] = CodecNew(
+	func(s string) ([]byte, error) { return []byte(s), nil },
+	func(b []byte) (string, error) { return string(b), nil },
+)
+
+var Uint64Codec Codec[uint64] = CodecNew(
+	fixed8Encoder(func(u uint64) uint64 { return u }),
+	fixed8Decoder("uint64", func(u uint64) uint64 { return u }),
+)
+
+const signBit uint64 = 1 << 63
+
+// Int64Codec encodes an int64 as big endian with the sign bit flipped(bytes sort as the values do).
+var Int64Codec Codec[int64] = CodecNew(
+	fixed8Encoder(func(i int64) uint64 { return uint64(i) ^ signBit }),
+	fixed8Decoder("int64", func(u uint64) int64 { return int64(u ^ signBit) }),
+)
+
+var Float64Codec Codec[float64] = CodecNew(
+	fixed8Encoder(math.Float64bits),
+	fixed8Decoder("float64", math.Float64frombits),
+)
+
+// TimeCodec encodes a time as unix nanos using Int64Codec.
+var TimeCodec Codec[time.Time] = CodecNew(
+	fixed8Encoder(func(t time.Time) uint64 { return uint64(t.UnixNano()) ^ signBit }),
+	fixed8Decoder("time", func(u uint64) time.Time { return time.Unix(0, int64(u^signBit)).UTC() }),
+)
+
+// OrderedInt64 encodes an int64 using Int64Codec.
+func OrderedInt64(i int64) []byte {
+	b, _ := Int64Codec.Encode(i)
+	return b
+}
+
+// OrderedTime encodes a time using TimeCodec.
+func OrderedTime(t time.Time) []byte {
+	b, _ := TimeCodec.Encode(t)
+	return b
+}
+
+func JsonCodecNew[T any]() Codec[T] {
+	return CodecNew(
+		func(t T) ([]byte, error) { return json.Marshal(t) },
+		func(b []byte) (t T, e error) {
+			e = json.Unmarshal(b, &t)
+			return
+		},
+	)
+}
+
+func CborCodecNew[T any]() Codec[T] {
+	return CodecNew(
+		func(t T) ([]byte, error) { return cbor.Marshal(t) },
+		func(b []byte) (t T, e error) {
+			e = cbor.Unmarshal(b, &t)
+			return
+		},
+	)
+}
@@ -0,0 +1,119 @@
+package stdb
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCodec(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Float64Codec", func(t *testing.T) {
+		t.Parallel()
+
+		b, e := Float64Codec.Encode(math.Pi)
+		if nil != e {
+			t.Fatalf("Unable to encode: %v", e)
+		}
+		checker(8, len(b), t)
+
+		f, e := Float64Codec.Decode(b)
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(math.Pi, f, t)
+
+		_, e = Float64Codec.Decode(b[1:])
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+	})
+
+	t.Run("Int64Codec", func(t *testing.T) {
+		t.Parallel()
+
+		b, e := Int64Codec.Encode(-42)
+		if nil != e {
+			t.Fatalf("Unable to encode: %v", e)
+		}
+		i, e := Int64Codec.Decode(b)
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(int64(-42), i, t)
+
+		checker(-1, bytes.Compare(OrderedInt64(math.MinInt64), OrderedInt64(-1)), t)
+		checker(-1, bytes.Compare(OrderedInt64(-1), OrderedInt64(0)), t)
+		checker(-1, bytes.Compare(OrderedInt64(0), OrderedInt64(math.MaxInt64)), t)
+	})
+
+	t.Run("TimeCodec", func(t *testing.T) {
+		t.Parallel()
+
+		var dt time.Time = time.Date(2022, time.August, 26, 1, 2, 3, 4, time.UTC)
+		b, e := TimeCodec.Encode(dt)
+		if nil != e {
+			t.Fatalf("Unable to encode: %v", e)
+		}
+		expected := []byte{0x97, 0x0e, 0xbf, 0x5e, 0x00, 0x59, 0xae, 0x04} // 1661475723000000004 ^ (1<<63)
+		checker(0, bytes.Compare(b, expected), t)
+
+		got, e := TimeCodec.Decode(b)
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(dt, got, t)
+
+		var old time.Time = time.Date(1969, time.December, 31, 23, 59, 59, 0, time.UTC)
+		checker(-1, bytes.Compare(OrderedTime(old), OrderedTime(dt)), t)
+		got, e = TimeCodec.Decode(OrderedTime(old))
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(old, got, t)
+	})
+
+	t.Run("JsonCodecNew", func(t *testing.T) {
+		t.Parallel()
+
+		type point struct {
+			X int `json:"x"`
+			Y int `json:"y"`
+		}
+
+		var c Codec[point] = JsonCodecNew[point]()
+		b, e := c.Encode(point{X: 1, Y: 2})
+		if nil != e {
+			t.Fatalf("Unable to encode: %v", e)
+		}
+		checker(`{"x":1,"y":2}`, string(b), t)
+
+		p, e := c.Decode(b)
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(point{X: 1, Y: 2}, p, t)
+
+		_, e = c.Decode([]byte("{"))
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+	})
+
+	t.Run("CborCodecNew", func(t *testing.T) {
+		t.Parallel()
+
+		var c Codec[map[string]float64] = CborCodecNew[map[string]float64]()
+		b, e := c.Encode(map[string]float64{"temp": 36.5})
+		if nil != e {
+			t.Fatalf("Unable to encode: %v", e)
+		}
+		m, e := c.Decode(b)
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(36.5, m["temp"], t)
+	})
+}
@@ -0,0 +1,236 @@
+// Package tscsv reads and writes samples as csv(id, date, key, val).
+//
+// Dates are RFC3339. Keys and values are encoded using an Encoding(hex, base64 or text).
+package tscsv
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+)
+
+var Header = []string{"id", "date", "key", "val"}
+
+// Encoding converts bytes to a csv field and back.
+type Encoding struct {
+	name   string
+	encode func(b []byte) (string, error)
+	decode func(s string) ([]byte, error)
+}
+
+func (c Encoding) String() string { return c.name }
+
+var (
+	Hex = Encoding{
+		name:   "hex",
+		encode: func(b []byte) (string, error) { return hex.EncodeToString(b), nil },
+		decode: hex.DecodeString,
+	}
+	Base64 = Encoding{
+		name:   "base64",
+		encode: func(b []byte) (string, error) { return base64.StdEncoding.EncodeToString(b), nil },
+		decode: base64.StdEncoding.DecodeString,
+	}
+
+	// Text uses bytes as is(must be valid utf-8).
+	Text = Encoding{
+		name: "text",
+		encode: func(b []byte) (string, error) {
+			if !utf8.Valid(b) {
+				return "", fmt.Errorf("Invalid utf-8")
+			}
+			return string(b), nil
+		},
+		decode: func(s string) ([]byte, error) { return []byte(s), nil },
+	}
+)
+
+// EncodingOf gets the encoding by the name(hex, base64, text).
+func EncodingOf(name string) (Encoding, error) {
+	for _, c := range []Encoding{Hex, Base64, Text} {
+		if name == c.name {
+			return c, nil
+		}
+	}
+	return Encoding{}, fmt.Errorf("Unknown encoding: %s", name)
+}
+
+type config struct {
+	key    Encoding
+	val    Encoding
+	header bool
+	comma  rune
+}
+
+type Option func(c *config)
+
+// KeyEncoding sets the encoding of keys(default: base64).
+func KeyEncoding(enc Encoding) Option { return func(c *config) { c.key = enc } }
+
+// ValEncoding sets the encoding of values(default: base64).
+func ValEncoding(enc Encoding) Option { return func(c *config) { c.val = enc } }
+
+// NoHeader disables the header row.
+func NoHeader() Option { return func(c *config) { c.header = false } }
+
+// Comma sets the field delimiter(default: ',').
+func Comma(r rune) Option { return func(c *config) { c.comma = r } }
+
+func configNew(opts []Option) config {
+	c := config{key: Base64, val: Base64, header: true, comma: ','}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+type row struct {
+	id   string
+	date time.Time
+	key  []byte
+	val  []byte
+}
+
+func (r *row) UseId(id string)      { r.id = id }
+func (r *row) UseDate(dt time.Time) { r.date = dt }
+func (r *row) UseKey(key []byte)    { r.key = key }
+func (r *row) UseVal(val []byte)    { r.val = val }
+
+type Writer struct {
+	cw     *csv.Writer
+	cfg    config
+	header bool // written
+}
+
+func WriterNew(w io.Writer, opts ...Option) *Writer {
+	var cfg config = configNew(opts)
+	cw := csv.NewWriter(w)
+	cw.Comma = cfg.comma
+	return &Writer{cw: cw, cfg: cfg, header: !cfg.header}
+}
+
+func (w *Writer) writeHeader() error {
+	if w.header {
+		return nil
+	}
+	w.header = true
+	return w.cw.Write(Header)
+}
+
+func (w *Writer) Write(s sp.TsSample) error {
+	e := w.writeHeader()
+	if nil != e {
+		return e
+	}
+	var r row
+	s.ForUser(&r)
+	key, e := w.cfg.key.encode(r.key)
+	if nil != e {
+		return fmt.Errorf("Invalid key(id: %s): %v", r.id, e)
+	}
+	val, e := w.cfg.val.encode(r.val)
+	if nil != e {
+		return fmt.Errorf("Invalid val(id: %s): %v", r.id, e)
+	}
+	return w.cw.Write([]string{r.id, r.date.Format(time.RFC3339Nano), key, val})
+}
+
+// Flush writes buffered rows(and the header if no rows are written).
+func (w *Writer) Flush() error {
+	e := w.writeHeader()
+	if nil != e {
+		return e
+	}
+	w.cw.Flush()
+	return w.cw.Error()
+}
+
+// WriteCsv writes all samples(e.g. samples got by a RangeRead).
+func WriteCsv(w io.Writer, samples s2k.Iter[sp.TsSample], opts ...Option) error {
+	cw := WriterNew(w, opts...)
+	for o := samples(); o.HasValue(); o = samples() {
+		e := cw.Write(o.Value())
+		if nil != e {
+			return e
+		}
+	}
+	return cw.Flush()
+}
+
+type Reader struct {
+	cr     *csv.Reader
+	cfg    config
+	header bool // skipped
+	err    error
+}
+
+func ReaderNew(r io.Reader, opts ...Option) *Reader {
+	var cfg config = configNew(opts)
+	cr := csv.NewReader(r)
+	cr.Comma = cfg.comma
+	cr.FieldsPerRecord = len(Header)
+	cr.ReuseRecord = true
+	return &Reader{cr: cr, cfg: cfg, header: !cfg.header}
+}
+
+// Read gets the next sample or io.EOF.
+func (r *Reader) Read() (sp.TsSample, error) {
+	if !r.header {
+		_, e := r.cr.Read()
+		if nil != e {
+			return sp.TsSample{}, e
+		}
+		r.header = true
+	}
+	rec, e := r.cr.Read()
+	if nil != e {
+		return sp.TsSample{}, e
+	}
+	line, _ := r.cr.FieldPos(0)
+	date, e := time.Parse(time.RFC3339Nano, rec[1])
+	if nil != e {
+		return sp.TsSample{}, fmt.Errorf("line %d: Invalid date: %v", line, e)
+	}
+	key, e := r.cfg.key.decode(rec[2])
+	if nil != e {
+		return sp.TsSample{}, fmt.Errorf("line %d: Invalid key: %v", line, e)
+	}
+	val, e := r.cfg.val.decode(rec[3])
+	if nil != e {
+		return sp.TsSample{}, fmt.Errorf("line %d: Invalid val: %v", line, e)
+	}
+	return sp.TsSampleNew(rec[0], date, key, val), nil
+}
+
+// Samples reads samples until the end or the first error(e.g. to feed a BatchSet).
+// Check Err() after the iteration.
+func (r *Reader) Samples() s2k.Iter[sp.TsSample] {
+	return func() s2k.Option[sp.TsSample] {
+		if nil != r.err {
+			return s2k.OptionEmptyNew[sp.TsSample]()
+		}
+		s, e := r.Read()
+		if nil != e {
+			r.err = e
+			return s2k.OptionEmptyNew[sp.TsSample]()
+		}
+		return s2k.OptionNew(s)
+	}
+}
+
+// Err gets the first error except io.EOF.
+func (r *Reader) Err() error {
+	if errors.Is(r.err, io.EOF) {
+		return nil
+	}
+	return r.err
+}
@@ -0,0 +1,139 @@
+package tscsv
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+)
+
+func checker[T comparable](t *testing.T, got T, expected T) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("Unexpected value got.\n")
+		t.Errorf("expected: %v\n", expected)
+		t.Errorf("got:      %v\n", got)
+	}
+}
+
+type dto struct {
+	id   string
+	date time.Time
+	key  string
+	val  string
+}
+
+func (d *dto) UseId(id string)      { d.id = id }
+func (d *dto) UseDate(dt time.Time) { d.date = dt }
+func (d *dto) UseKey(key []byte)    { d.key = string(key) }
+func (d *dto) UseVal(val []byte)    { d.val = string(val) }
+
+func toDto(s sp.TsSample) (d dto) {
+	s.ForUser(&d)
+	return
+}
+
+func TestCsv(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 678000000, time.UTC)
+	samples := []sp.TsSample{
+		sp.TsSampleNew("cafef00d", dt, []byte{0x00, 0x01}, []byte("21.5")),
+		sp.TsSampleNew("cafef00d", dt.Add(time.Second), []byte{0x00, 0x02}, []byte(`{"temp":"a,b"}`)),
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		for _, opts := range [][]Option{
+			nil,
+			{KeyEncoding(Hex), ValEncoding(Text)},
+			{KeyEncoding(Hex), ValEncoding(Hex), NoHeader(), Comma(';')},
+		} {
+			var buf bytes.Buffer
+			e := WriteCsv(&buf, s2k.IterFromArray(samples), opts...)
+			if nil != e {
+				t.Fatalf("Unable to write: %v", e)
+			}
+
+			r := ReaderNew(&buf, opts...)
+			got := r.Samples().ToArray()
+			if nil != r.Err() {
+				t.Fatalf("Unable to read: %v", r.Err())
+			}
+			checker(t, len(got), 2)
+			for i := range got {
+				checker(t, toDto(got[i]).id, toDto(samples[i]).id)
+				checker(t, toDto(got[i]).date.Equal(toDto(samples[i]).date), true)
+				checker(t, toDto(got[i]).key, toDto(samples[i]).key)
+				checker(t, toDto(got[i]).val, toDto(samples[i]).val)
+			}
+		}
+	})
+
+	t.Run("format", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		e := WriteCsv(&buf, s2k.IterFromArray(samples[:1]), KeyEncoding(Hex), ValEncoding(Text))
+		if nil != e {
+			t.Fatalf("Unable to write: %v", e)
+		}
+		checker(t, buf.String(), "id,date,key,val\ncafef00d,2022-08-26T13:14:15.678Z,0001,21.5\n")
+
+		buf.Reset()
+		_ = WriteCsv(&buf, s2k.IterEmptyNew[sp.TsSample]())
+		checker(t, buf.String(), "id,date,key,val\n")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		e := WriteCsv(&buf, s2k.IterFromArray([]sp.TsSample{
+			sp.TsSampleNew("cafef00d", dt, nil, []byte{0xff}),
+		}), ValEncoding(Text))
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+
+		r := ReaderNew(strings.NewReader("id,date,key,val\ncafef00d,2022-08-26T13:14:15Z,AA==,zz\n"), ValEncoding(Hex))
+		checker(t, len(r.Samples().ToArray()), 0)
+		checker(t, strings.HasPrefix(r.Err().Error(), "line 2: Invalid val"), true)
+
+		r = ReaderNew(strings.NewReader("cafef00d,yesterday,,\n"), NoHeader())
+		checker(t, len(r.Samples().ToArray()), 0)
+		if nil == r.Err() {
+			t.Errorf("Must fail")
+		}
+
+		_, e = EncodingOf("rot13")
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+		enc, _ := EncodingOf("hex")
+		checker(t, enc.String(), "hex")
+	})
+
+	t.Run("BatchSet", func(t *testing.T) {
+		t.Parallel()
+
+		var got []sp.TsSample
+		var bset sp.BatchSet = func(_ context.Context, many s2k.Iter[sp.TsSample]) error {
+			got = many.ToArray()
+			return nil
+		}
+		r := ReaderNew(strings.NewReader("id,date,key,val\ncafef00d,2022-08-26T13:14:15Z,azE=,djE=\n"))
+		e := bset(context.Background(), r.Samples())
+		if nil != e || nil != r.Err() {
+			t.Fatalf("Unable to set: %v, %v", e, r.Err())
+		}
+		checker(t, len(got), 1)
+		checker(t, toDto(got[0]).key, "k1")
+	})
+}
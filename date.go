@@ -1,6 +1,8 @@
 package stdb
 
 import (
+	"fmt"
+	"regexp"
 	"time"
 )
 
@@ -8,10 +10,131 @@ const patYmd = "20060102"
 
 type Date2Str func(t time.Time) string
 
+// Str2Interval parses a label created by Date2Str and returns [start, end).
+type Str2Interval func(label string) (start, end time.Time, e error)
+
 func NewDateConverter(format string) Date2Str {
 	return func(t time.Time) string {
 		return t.Format(format)
 	}
 }
 
+// NewDateConverterInLocation creates a converter which formats the time in the location.
+// The same instant always gets the same label regardless of the location of the time.
+func NewDateConverterInLocation(format string, loc *time.Location) Date2Str {
+	return func(t time.Time) string {
+		return t.In(loc).Format(format)
+	}
+}
+
 var YmdConverter Date2Str = NewDateConverter(patYmd)
+
+// labels are used as a part of table names
+var partitionSafe *regexp.Regexp = regexp.MustCompile(`^[0-9a-z_]+$`)
+
+var dateRef time.Time = time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+
+type dateUnit struct {
+	name    string
+	changed time.Time
+	next    func(start time.Time) time.Time // start must be in the location of the label
+}
+
+// ordered from the smallest unit
+// days, months and years use the wall clock(a day may have 23 or 25 hours)
+var dateUnits []dateUnit = []dateUnit{
+	{"second", dateRef.Add(time.Second), func(s time.Time) time.Time { return s.Add(time.Second) }},
+	{"minute", dateRef.Add(time.Minute), func(s time.Time) time.Time { return s.Add(time.Minute) }},
+	{"hour", dateRef.Add(time.Hour), func(s time.Time) time.Time { return s.Add(time.Hour) }},
+	{"day", dateRef.AddDate(0, 0, 1), func(s time.Time) time.Time { return s.AddDate(0, 0, 1) }},
+	{"month", dateRef.AddDate(0, 1, 0), func(s time.Time) time.Time { return s.AddDate(0, 1, 0) }},
+	{"year", dateRef.AddDate(1, 0, 0), func(s time.Time) time.Time { return s.AddDate(1, 0, 0) }},
+}
+
+// nextLabel finds the start of the next label.
+// A label may last longer than its unit(e.g. 01:00-02:00 repeated when the DST ends).
+func (u dateUnit) nextLabel(start time.Time, label string, format Date2Str) time.Time {
+	var end time.Time = u.next(start)
+	for label == format(end) {
+		end = u.next(end)
+	}
+	return end
+}
+
+// dateFormatUnit finds the smallest unit of the format.
+// All larger units must also be in the format to make the label reversible.
+func dateFormatUnit(format string) (unit dateUnit, e error) {
+	var ref string = dateRef.Format(format)
+	var found bool = false
+	for _, u := range dateUnits {
+		var distinct bool = ref != u.changed.Format(format)
+		switch {
+		case distinct && !found:
+			found = true
+			unit = u
+		case !distinct && found:
+			return unit, fmt.Errorf("Ambiguous format(no %s): %s", u.name, format)
+		}
+	}
+	if !found {
+		return unit, fmt.Errorf("Constant format: %s", format)
+	}
+	if ref != dateRef.Add(time.Millisecond).Format(format) {
+		return unit, fmt.Errorf("Sub-second format is not supported: %s", format)
+	}
+	return unit, nil
+}
+
+// ValidateDateFormat checks if labels of the format can be used in table names and can be parsed.
+func ValidateDateFormat(format string) error {
+	samples := []time.Time{
+		dateRef,
+		time.Date(1999, time.December, 31, 23, 59, 59, 0, time.UTC),
+	}
+	for _, s := range samples {
+		var label string = s.Format(format)
+		if !partitionSafe.MatchString(label) {
+			return fmt.Errorf("Unsafe label(%s) for format: %s", label, format)
+		}
+	}
+	_, e := dateFormatUnit(format)
+	return e
+}
+
+// NewDateParser creates the counterpart of NewDateConverter(format) for UTC labels.
+func NewDateParser(format string) (Str2Interval, error) {
+	return NewDateParserInLocation(format, time.UTC)
+}
+
+// NewDateParserInLocation creates the counterpart of NewDateConverterInLocation(format, loc).
+func NewDateParserInLocation(format string, loc *time.Location) (Str2Interval, error) {
+	e := ValidateDateFormat(format)
+	if nil != e {
+		return nil, e
+	}
+	unit, _ := dateFormatUnit(format)
+	var d2s Date2Str = NewDateConverterInLocation(format, loc)
+	return func(label string) (start, end time.Time, e error) {
+		start, e = time.ParseInLocation(format, label, loc)
+		if nil != e {
+			return
+		}
+		if label != d2s(start) {
+			// e.g. skipped by the DST
+			return start, end, fmt.Errorf("Invalid label: %s", label)
+		}
+		if label == d2s(start.Add(-time.Hour)) {
+			// use the earlier one of the repeated wall clock(DST end)
+			start = start.Add(-time.Hour)
+		}
+		return start, unit.nextLabel(start, label, d2s), nil
+	}, nil
+}
+
+func newDateParserMust(format string, loc *time.Location) Str2Interval {
+	parser, e := NewDateParserInLocation(format, loc)
+	if nil != e {
+		panic(e)
+	}
+	return parser
+}
@@ -19,3 +19,69 @@ func TestYmdConverter(t *testing.T) {
 		}
 	})
 }
+
+func TestNewDateParser(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ymd", func(t *testing.T) {
+		t.Parallel()
+
+		parser, e := NewDateParser(patYmd)
+		if nil != e {
+			t.Fatalf("Unable to get parser: %v", e)
+		}
+
+		var dt time.Time = time.Date(2022, time.August, 26, 13, 0, 0, 0, time.UTC)
+		start, end, e := parser(YmdConverter(dt))
+		if nil != e {
+			t.Fatalf("Unable to parse: %v", e)
+		}
+		checker(time.Date(2022, time.August, 26, 0, 0, 0, 0, time.UTC), start, t)
+		checker(time.Date(2022, time.August, 27, 0, 0, 0, 0, time.UTC), end, t)
+
+		_, _, e = parser("20220832")
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+	})
+
+	t.Run("minutes", func(t *testing.T) {
+		t.Parallel()
+
+		parser, e := NewDateParser("20060102_1504")
+		if nil != e {
+			t.Fatalf("Unable to get parser: %v", e)
+		}
+		start, end, e := parser("20220826_1330")
+		if nil != e {
+			t.Fatalf("Unable to parse: %v", e)
+		}
+		checker(time.Date(2022, time.August, 26, 13, 30, 0, 0, time.UTC), start, t)
+		checker(time.Minute, end.Sub(start), t)
+	})
+
+	t.Run("invalid formats", func(t *testing.T) {
+		t.Parallel()
+
+		formats := []string{
+			"2006-01-02",         // separator
+			"2006/01/02",         // separator
+			"2006Jan02",          // upper case
+			"20060102 15",        // space
+			"0102",               // no year
+			"2006_02",            // no month
+			"20060102150405.000", // sub-second
+			"data",               // constant
+		}
+		for _, f := range formats {
+			e := ValidateDateFormat(f)
+			if nil == e {
+				t.Errorf("Must fail: %s", f)
+			}
+			_, e = NewDateParser(f)
+			if nil == e {
+				t.Errorf("Must fail: %s", f)
+			}
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package stdb
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+// IndexCache remembers recently written index entries(bucket, key) up to the size.
+type IndexCache struct {
+	lk      sync.Mutex
+	entries *lru
+}
+
+// IndexCacheNew creates a cache(unlimited if the size is 0).
+func IndexCacheNew(size int) *IndexCache {
+	return &IndexCache{entries: lruNew(size)}
+}
+
+func (c *IndexCache) Has(key string) bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	_, found := c.entries.peek(key)
+	c.entries.touch(key)
+	return found
+}
+
+func (c *IndexCache) Add(key string) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.entries.add(key, time.Time{})
+}
+
+// InvalidateBucket forgets entries of the bucket. Use this after dropping the bucket.
+func (c *IndexCache) InvalidateBucket(bucket string) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	var prefix string = bucket + "\x00"
+	c.entries.removeIf(func(key string) bool { return strings.HasPrefix(key, prefix) })
+}
+
+func (c *IndexCache) Len() int {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.entries.len()
+}
+
+func batchKey(b s2k.Batch) string { return b.Bucket() + "\x00" + string(b.Pair().Key) }
+
+// batchDedup coalesces identical index entries in a batch.
+type batchDedup struct {
+	seen  map[string]struct{}
+	cache *IndexCache // optional
+}
+
+func batchDedupNew(cache *IndexCache) *batchDedup {
+	return &batchDedup{
+		seen:  make(map[string]struct{}),
+		cache: cache,
+	}
+}
+
+func (d *batchDedup) append(batches []s2k.Batch, ts TsSample, d2s Date2Str) []s2k.Batch {
+	return d.appendNamed(batches, ts, d2s, "")
+}
+
+// appendNamed records the partitioner name in dates_<id>.
+func (d *batchDedup) appendNamed(batches []s2k.Batch, ts TsSample, d2s Date2Str, name string) []s2k.Batch {
+	var ymd string = d2s(ts.date)
+	for _, b := range ts.toNamedIndexBatch(ymd, name) {
+		var key string = batchKey(b)
+		if _, dup := d.seen[key]; dup {
+			continue
+		}
+		d.seen[key] = struct{}{}
+		if nil != d.cache && d.cache.Has(key) {
+			continue
+		}
+		batches = append(batches, b)
+	}
+	return append(batches, ts.toDataBatch(ymd))
+}
+
+// commit adds the written index entries to the cache.
+func (d *batchDedup) commit() {
+	if nil == d.cache {
+		return
+	}
+	for key := range d.seen {
+		d.cache.Add(key)
+	}
+}
@@ -0,0 +1,132 @@
+package stdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+type batchRecorder struct {
+	batches []s2k.Batch
+	err     error
+}
+
+func (r *batchRecorder) SetBatch(_ context.Context, many s2k.Iter[s2k.Batch]) error {
+	r.batches = append(r.batches, many.ToArray()...)
+	return r.err
+}
+
+func noopAdder(_ context.Context, _ string) error { return nil }
+
+func TestDedup(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 0, time.UTC)
+
+	samplesNew := func(id string, n int) s2k.Iter[TsSample] {
+		var s []TsSample
+		for i := 0; i < n; i++ {
+			s = append(s, TsSampleNew(id, dt.Add(time.Duration(i)*time.Second), []byte(fmt.Sprint(i)), nil))
+		}
+		return s2k.IterFromArray(s)
+	}
+
+	t.Run("same device same day", func(t *testing.T) {
+		t.Parallel()
+
+		var r batchRecorder
+		e := NewBatchSetter(noopAdder, r.SetBatch, 1024)(YmdConverter)(context.Background(), samplesNew("cafef00d", 100))
+		if nil != e {
+			t.Fatalf("Unable to set: %v", e)
+		}
+		checker(104, len(r.batches), t)
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		t.Parallel()
+
+		var cache *IndexCache = IndexCacheNew(16)
+		var r batchRecorder
+		var bset BatchSet = NewCachedBatchSetter(noopAdder, r.SetBatch, 1024, cache)(YmdConverter)
+
+		e := bset(context.Background(), samplesNew("cafef00d", 10))
+		if nil != e {
+			t.Fatalf("Unable to set: %v", e)
+		}
+		checker(14, len(r.batches), t)
+		checker(4, cache.Len(), t)
+
+		r.batches = nil
+		e = bset(context.Background(), samplesNew("cafef00d", 10))
+		if nil != e {
+			t.Fatalf("Unable to set: %v", e)
+		}
+		checker(10, len(r.batches), t)
+	})
+
+	t.Run("cache not updated on error", func(t *testing.T) {
+		t.Parallel()
+
+		var cache *IndexCache = IndexCacheNew(16)
+		r := batchRecorder{err: fmt.Errorf("rejected")}
+		var bset BatchSet = NewCachedBatchSetter(noopAdder, r.SetBatch, 1024, cache)(YmdConverter)
+
+		e := bset(context.Background(), samplesNew("cafef00d", 10))
+		if nil == e {
+			t.Fatalf("Must fail")
+		}
+		checker(0, cache.Len(), t)
+	})
+
+	t.Run("batch limit exceeded", func(t *testing.T) {
+		t.Parallel()
+
+		var cache *IndexCache = IndexCacheNew(16)
+		var r batchRecorder
+		var bset BatchSet = NewCachedBatchSetter(noopAdder, r.SetBatch, 2, cache)(YmdConverter)
+
+		e := bset(context.Background(), samplesNew("cafef00d", 10))
+		if !errors.Is(e, ErrBatchLimit) {
+			t.Fatalf("Must fail: %v", e)
+		}
+		checker(0, len(r.batches), t)
+		checker(0, cache.Len(), t)
+	})
+
+	t.Run("ChunkedBatchSet", func(t *testing.T) {
+		t.Parallel()
+
+		var r batchRecorder
+		var calls int
+		var bset BatchSet = NewBatchSetter(noopAdder, r.SetBatch, BatchesPerSample*3)(YmdConverter)
+		var chunked BatchSet = ChunkedBatchSet(func(ctx context.Context, many s2k.Iter[TsSample]) error {
+			calls += 1
+			return bset(ctx, many)
+		}, 3)
+
+		e := chunked(context.Background(), samplesNew("cafef00d", 10))
+		if nil != e {
+			t.Fatalf("Unable to set: %v", e)
+		}
+		checker(4, calls, t)
+		checker(4*4+10, len(r.batches), t) // index entries are written once per chunk
+	})
+
+	t.Run("IndexCache eviction", func(t *testing.T) {
+		t.Parallel()
+
+		var cache *IndexCache = IndexCacheNew(2)
+		cache.Add("a")
+		cache.Add("b")
+		checker(true, cache.Has("a"), t) // b is the least recently used
+		cache.Add("c")
+		checker(2, cache.Len(), t)
+		checker(true, cache.Has("a"), t)
+		checker(false, cache.Has("b"), t)
+		checker(true, cache.Has("c"), t)
+	})
+}
@@ -0,0 +1,142 @@
+package expq
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	tsarw "github.com/takanoriyanagitani/go-spacetimedb/arrow"
+)
+
+const defaultRowGroupSize int64 = 65536
+
+var (
+	Uncompressed compress.Compression = compress.Codecs.Uncompressed
+	Snappy       compress.Compression = compress.Codecs.Snappy
+	Gzip         compress.Compression = compress.Codecs.Gzip
+	Zstd         compress.Compression = compress.Codecs.Zstd
+)
+
+type config struct {
+	rowGroupSize int64
+	compression  compress.Compression
+}
+
+type Option func(c *config)
+
+// RowGroupSize sets the max number of rows in a row group.
+func RowGroupSize(rows int64) Option {
+	return func(c *config) {
+		if 0 < rows {
+			c.rowGroupSize = rows
+		}
+	}
+}
+
+func Compression(codec compress.Compression) Option {
+	return func(c *config) { c.compression = codec }
+}
+
+type Exporter struct {
+	fw           *pqarrow.FileWriter
+	bld          *tsarw.RecordBuilder
+	rowGroupSize int64
+}
+
+func ExporterNew(w io.Writer, opts ...Option) (*Exporter, error) {
+	cfg := config{
+		rowGroupSize: defaultRowGroupSize,
+		compression:  Snappy,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	props := parquet.NewWriterProperties(
+		parquet.WithMaxRowGroupLength(cfg.rowGroupSize),
+		parquet.WithCompression(cfg.compression),
+	)
+	fw, e := pqarrow.NewFileWriter(tsarw.Schema, w, props, pqarrow.DefaultWriterProps())
+	if nil != e {
+		return nil, e
+	}
+
+	return &Exporter{
+		fw:           fw,
+		bld:          tsarw.RecordBuilderNew(memory.DefaultAllocator),
+		rowGroupSize: cfg.rowGroupSize,
+	}, nil
+}
+
+func (x *Exporter) pending() int64 { return int64(x.bld.Len()) }
+
+func (x *Exporter) flush() error {
+	if 0 == x.pending() {
+		return nil
+	}
+	rec := x.bld.NewRecordBatch()
+	defer rec.Release()
+	return x.fw.Write(rec) // a row group per record
+}
+
+func (x *Exporter) Write(samples s2k.Iter[sp.TsSample]) error {
+	for o := samples(); o.HasValue(); o = samples() {
+		x.bld.Append(o.Value())
+		if x.rowGroupSize <= x.pending() {
+			e := x.flush()
+			if nil != e {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+func (x *Exporter) Close() error {
+	defer x.bld.Release()
+	e := x.flush()
+	if nil != e {
+		_ = x.fw.Close()
+		return e
+	}
+	return x.fw.Close()
+}
+
+func export(w io.Writer, samples s2k.Iter[sp.TsSample], opts []Option) error {
+	x, e := ExporterNew(w, opts...)
+	if nil != e {
+		return e
+	}
+	e = x.Write(samples)
+	if nil != e {
+		_ = x.Close()
+		return e
+	}
+	return x.Close()
+}
+
+// ExportPartition writes all samples in data_<ymd>_<id> as a parquet file.
+func ExportPartition(ctx context.Context, read sp.PartitionRead, id string, date time.Time, w io.Writer, opts ...Option) error {
+	samples, e := read(ctx, id, date)
+	if nil != e {
+		return e
+	}
+	return export(w, samples, opts)
+}
+
+// ExportDay writes all samples of all devices in devices_<ymd> as a parquet file.
+func ExportDay(ctx context.Context, read sp.DayRead, date time.Time, w io.Writer, opts ...Option) error {
+	samples, e := read(ctx, date)
+	if nil != e {
+		return e
+	}
+	return export(w, samples, opts)
+}
@@ -0,0 +1,116 @@
+package expq
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+)
+
+func checker[T comparable](t *testing.T, got T, expected T) {
+	if got != expected {
+		t.Errorf("Unexpected value got.\n")
+		t.Errorf("expected: %v\n", expected)
+		t.Errorf("got:      %v\n", got)
+	}
+}
+
+func TestExpq(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 0, 0, 0, 0, time.UTC)
+
+	var read sp.PartitionRead = func(_ context.Context, id string, date time.Time) (s2k.Iter[sp.TsSample], error) {
+		return s2k.IterFromArray([]sp.TsSample{
+			sp.TsSampleNew(id, date, []byte("k0"), []byte("v0")),
+			sp.TsSampleNew(id, date, []byte("k1"), []byte("v1")),
+			sp.TsSampleNew(id, date, []byte("k2"), []byte("v2")),
+		}), nil
+	}
+
+	t.Run("ExportPartition", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		e := ExportPartition(
+			context.Background(),
+			read,
+			"cafef00d",
+			dt,
+			&buf,
+			RowGroupSize(2),
+			Compression(Zstd),
+		)
+		if nil != e {
+			t.Fatalf("Unable to export: %v", e)
+		}
+
+		rdr, e := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+		if nil != e {
+			t.Fatalf("Unable to read: %v", e)
+		}
+		defer rdr.Close()
+
+		checker(t, rdr.NumRows(), 3)
+		checker(t, rdr.NumRowGroups(), 2)
+
+		cc, e := rdr.MetaData().RowGroup(0).ColumnChunk(3)
+		if nil != e {
+			t.Fatalf("Unable to get column chunk: %v", e)
+		}
+		checker(t, cc.Compression(), Zstd)
+
+		tbl, e := pqarrow.ReadTable(
+			context.Background(),
+			bytes.NewReader(buf.Bytes()),
+			parquet.NewReaderProperties(memory.DefaultAllocator),
+			pqarrow.ArrowReadProperties{},
+			memory.DefaultAllocator,
+		)
+		if nil != e {
+			t.Fatalf("Unable to read table: %v", e)
+		}
+		defer tbl.Release()
+
+		checker(t, tbl.NumCols(), 4)
+		ids := tbl.Column(0).Data().Chunk(0).(*array.String)
+		checker(t, ids.Value(0), "cafef00d")
+		vals := tbl.Column(3).Data().Chunk(0).(*array.Binary)
+		checker(t, string(vals.Value(2)), "v2")
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		x, e := ExporterNew(&buf)
+		if nil != e {
+			t.Fatalf("Unable to create exporter: %v", e)
+		}
+		e = x.Write(s2k.IterEmptyNew[sp.TsSample]())
+		if nil != e {
+			t.Errorf("Must be nop: %v", e)
+		}
+		e = x.Close()
+		if nil != e {
+			t.Errorf("Unable to close: %v", e)
+		}
+
+		rdr, e := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+		if nil != e {
+			t.Fatalf("Unable to read: %v", e)
+		}
+		defer rdr.Close()
+		checker(t, rdr.NumRows(), 0)
+	})
+}
@@ -0,0 +1,212 @@
+// Package httpd provides net/http handlers to write and read samples.
+package httpd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	vlcb "github.com/takanoriyanagitani/go-spacetimedb/vlog/cbor"
+)
+
+const (
+	ContentTypeCbor = "application/cbor"
+	ContentTypeJson = "application/json"
+
+	defaultMaxBytes  int64 = 16 << 20
+	defaultBatchSize int   = 1024
+)
+
+// IngestResult is the response body of the ingest handler.
+type IngestResult struct {
+	Accepted int      `json:"accepted"`
+	Rejected int      `json:"rejected"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+type ingestConfig struct {
+	vlogs     map[string]sp.Vlog
+	validate  sp.IdValidator
+	maxBytes  int64
+	batchSize int
+}
+
+type IngestOption func(c *ingestConfig)
+
+// WithVlog accepts bodies of the content type using the vlog.
+func WithVlog(contentType string, v sp.Vlog) IngestOption {
+	return func(c *ingestConfig) { c.vlogs[contentType] = v }
+}
+
+func WithIdValidator(v sp.IdValidator) IngestOption {
+	return func(c *ingestConfig) { c.validate = v }
+}
+
+// WithMaxBytes limits the size of request bodies.
+func WithMaxBytes(n int64) IngestOption {
+	return func(c *ingestConfig) { c.maxBytes = n }
+}
+
+// WithBatchSize limits the number of samples written by a BatchSet call(default: 1024).
+// The limit of the batch setter must be sp.BatchesPerSample times the size or more.
+func WithBatchSize(n int) IngestOption {
+	return func(c *ingestConfig) { c.batchSize = n }
+}
+
+// PartialUnpacker unpacks valid samples and reports malformed records instead of failing.
+// Vlogs registered by WithVlog may implement this to reject only malformed records.
+type PartialUnpacker interface {
+	UnpackPartial(packed []byte) (unpacked []sp.TsSample, malformed []error)
+}
+
+// cborVlog unpacks the cbor vlog record by record.
+type cborVlog struct{ sp.Vlog }
+
+func (c cborVlog) UnpackPartial(packed []byte) (unpacked []sp.TsSample, malformed []error) {
+	_ = vlcb.Walk(packed, func(r vlcb.Record) error {
+		if r.Valid() || errors.Is(r.Err, vlcb.ErrNoDate) {
+			unpacked = append(unpacked, r.Sample.ToSample()) // samples without dates are rejected later
+			return nil
+		}
+		malformed = append(malformed, fmt.Errorf("Malformed record(offset=%d, size=%d): %v", r.Offset, r.Size, r.Err))
+		return nil
+	})
+	return
+}
+
+type jsonVlog struct{}
+
+func (j jsonVlog) Pack(samples []sp.TsSample) ([]byte, error) {
+	dtos := make([]sp.JsonSample, 0, len(samples))
+	for _, s := range samples {
+		var dto vlcb.SampleDto
+		s.ForUser(&dto)
+		dtos = append(dtos, sp.JsonSample(dto))
+	}
+	return json.Marshal(dtos)
+}
+
+func (j jsonVlog) Unpack(packed []byte) (unpacked []sp.TsSample, e error) {
+	var dtos []sp.JsonSample
+	e = json.Unmarshal(packed, &dtos)
+	if nil != e {
+		return nil, e
+	}
+	for _, dto := range dtos {
+		unpacked = append(unpacked, sp.TsSampleNew(dto.Id, dto.Date, dto.Key, dto.Val))
+	}
+	return unpacked, nil
+}
+
+// JsonVlogNew creates a vlog which packs samples as a json array of sp.JsonSample.
+func JsonVlogNew() sp.Vlog { return jsonVlog{} }
+
+func writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", ContentTypeJson)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (c *ingestConfig) split(samples []sp.TsSample) (accepted []sp.TsSample, result IngestResult) {
+	for _, s := range samples {
+		var dto vlcb.SampleDto
+		s.ForUser(&dto)
+		e := c.validate(dto.Id)
+		if nil == e && dto.Date.IsZero() {
+			e = fmt.Errorf("No date: %q", dto.Id)
+		}
+		if nil != e {
+			result.Rejected += 1
+			result.Errors = append(result.Errors, e.Error())
+			continue
+		}
+		accepted = append(accepted, s)
+	}
+	result.Accepted = len(accepted)
+	return
+}
+
+// IngestHandlerNew creates a handler which writes POSTed samples using the batch setter.
+//
+// Content types:
+//
+//	application/cbor: cbor vlog(a sequence of samples)
+//	application/json: an array of sp.JsonSample
+//
+// Samples with invalid ids and malformed cbor records are rejected(other samples are written).
+func IngestHandlerNew(bset sp.BatchSet, opts ...IngestOption) http.Handler {
+	c := &ingestConfig{
+		vlogs: map[string]sp.Vlog{
+			ContentTypeCbor: cborVlog{vlcb.CborVlogNew().AsVlog()},
+			ContentTypeJson: JsonVlogNew(),
+		},
+		validate:  sp.DefaultIdValidator,
+		maxBytes:  defaultMaxBytes,
+		batchSize: defaultBatchSize,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	var write sp.BatchSet = sp.ChunkedBatchSet(bset, c.batchSize)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodPost != r.Method {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		mediaType, _, e := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		v, ok := c.vlogs[mediaType]
+		if nil != e || !ok {
+			http.Error(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, e := io.ReadAll(http.MaxBytesReader(w, r.Body, c.maxBytes))
+		if nil != e {
+			var tooLarge *http.MaxBytesError
+			if errors.As(e, &tooLarge) {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Unable to read the body", http.StatusBadRequest)
+			return
+		}
+
+		var samples []sp.TsSample
+		var malformed []error
+		if pu, ok := v.(PartialUnpacker); ok {
+			samples, malformed = pu.UnpackPartial(body)
+		} else {
+			samples, e = v.Unpack(body)
+			if nil != e {
+				http.Error(w, fmt.Sprintf("Invalid body: %v", e), http.StatusBadRequest)
+				return
+			}
+		}
+
+		accepted, result := c.split(samples)
+		result.Rejected += len(malformed)
+		for _, m := range malformed {
+			result.Errors = append(result.Errors, m.Error())
+		}
+		if 0 < len(accepted) {
+			e = write(r.Context(), s2k.IterFromArray(accepted))
+			if nil != e {
+				writeJson(w, http.StatusInternalServerError, IngestResult{
+					Rejected: result.Accepted + result.Rejected,
+					Errors:   append(result.Errors, fmt.Sprintf("Unable to write: %v", e)),
+				})
+				return
+			}
+		}
+		writeJson(w, http.StatusOK, result)
+	})
+}
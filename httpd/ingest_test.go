@@ -0,0 +1,212 @@
+package httpd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	vlcb "github.com/takanoriyanagitani/go-spacetimedb/vlog/cbor"
+)
+
+func checker[T comparable](t *testing.T, got T, expected T) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("Unexpected value got.\n")
+		t.Errorf("expected: %v\n", expected)
+		t.Errorf("got:      %v\n", got)
+	}
+}
+
+type recorder struct{ samples []sp.TsSample }
+
+func (r *recorder) BatchSet(_ context.Context, many s2k.Iter[sp.TsSample]) error {
+	r.samples = append(r.samples, many.ToArray()...)
+	return nil
+}
+
+func post(t *testing.T, h http.Handler, contentType string, body []byte) (*httptest.ResponseRecorder, IngestResult) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/samples", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var result IngestResult
+	if strings.HasPrefix(rec.Header().Get("Content-Type"), ContentTypeJson) {
+		e := json.Unmarshal(rec.Body.Bytes(), &result)
+		if nil != e {
+			t.Fatalf("Invalid response: %v", e)
+		}
+	}
+	return rec, result
+}
+
+func TestIngest(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 0, time.UTC)
+
+	t.Run("cbor", func(t *testing.T) {
+		t.Parallel()
+
+		var r recorder
+		var h http.Handler = IngestHandlerNew(r.BatchSet)
+		packed, e := vlcb.CborVlogNew().Pack([]sp.TsSample{
+			sp.TsSampleNew("cafef00d", dt, []byte("k0"), []byte("v0")),
+			sp.TsSampleNew("DROP TABLE", dt, []byte("k1"), []byte("v1")),
+			sp.TsSampleNew("cafef00d", dt, []byte("k2"), []byte("v2")),
+		})
+		if nil != e {
+			t.Fatalf("Unable to pack: %v", e)
+		}
+
+		rec, result := post(t, h, ContentTypeCbor, packed)
+		checker(t, rec.Code, http.StatusOK)
+		checker(t, result.Accepted, 2)
+		checker(t, result.Rejected, 1)
+		checker(t, len(r.samples), 2)
+	})
+
+	t.Run("cbor malformed", func(t *testing.T) {
+		t.Parallel()
+
+		pack := func(keys ...string) []byte {
+			var samples []sp.TsSample
+			for _, key := range keys {
+				samples = append(samples, sp.TsSampleNew("cafef00d", dt, []byte(key), []byte("v")))
+			}
+			packed, _ := vlcb.CborVlogNew().Pack(samples)
+			return packed
+		}
+		var body []byte = pack("k0", "k1")
+		body = append(body, 0xff, 0xff) // garbage
+		body = append(body, pack("k2", "k3")...)
+
+		var r recorder
+		rec, result := post(t, IngestHandlerNew(r.BatchSet), ContentTypeCbor, body)
+		checker(t, rec.Code, http.StatusOK)
+		checker(t, result.Accepted, 4)
+		checker(t, result.Rejected, 1)
+		checker(t, len(result.Errors), 1)
+		checker(t, len(r.samples), 4)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+
+		var r recorder
+		var h http.Handler = IngestHandlerNew(r.BatchSet)
+		body := []byte(`[
+			{"id":"cafef00d","date":"2022-08-26T13:14:15Z","key":"azA=","val":"djA="},
+			{"id":"cafef00d","key":"azE=","val":"djE="}
+		]`)
+
+		rec, result := post(t, h, "application/json; charset=utf-8", body)
+		checker(t, rec.Code, http.StatusOK)
+		checker(t, result.Accepted, 1)
+		checker(t, result.Rejected, 1)
+
+		var dto vlcb.SampleDto
+		r.samples[0].ForUser(&dto)
+		checker(t, string(dto.Key), "k0")
+		checker(t, dto.Date.Equal(dt), true)
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		t.Parallel()
+
+		var r recorder
+		rec, _ := post(t, IngestHandlerNew(r.BatchSet), ContentTypeJson, []byte(`{`))
+		checker(t, rec.Code, http.StatusBadRequest)
+	})
+
+	t.Run("unsupported content type", func(t *testing.T) {
+		t.Parallel()
+
+		var r recorder
+		rec, _ := post(t, IngestHandlerNew(r.BatchSet), "text/plain", nil)
+		checker(t, rec.Code, http.StatusUnsupportedMediaType)
+	})
+
+	t.Run("method", func(t *testing.T) {
+		t.Parallel()
+
+		var r recorder
+		rec := httptest.NewRecorder()
+		IngestHandlerNew(r.BatchSet).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/samples", nil))
+		checker(t, rec.Code, http.StatusMethodNotAllowed)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		t.Parallel()
+
+		var r recorder
+		var h http.Handler = IngestHandlerNew(r.BatchSet, WithMaxBytes(4))
+		rec, _ := post(t, h, ContentTypeJson, []byte(`[{"id":"cafef00d"}]`))
+		checker(t, rec.Code, http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		t.Parallel()
+
+		var h http.Handler = IngestHandlerNew(func(_ context.Context, _ s2k.Iter[sp.TsSample]) error {
+			return fmt.Errorf("Must fail")
+		})
+		body := []byte(`[{"id":"cafef00d","date":"2022-08-26T13:14:15Z"}]`)
+		rec, result := post(t, h, ContentTypeJson, body)
+		checker(t, rec.Code, http.StatusInternalServerError)
+		checker(t, result.Accepted, 0)
+		checker(t, result.Rejected, 1)
+	})
+
+	t.Run("batch size", func(t *testing.T) {
+		t.Parallel()
+
+		var r recorder
+		var calls int
+		var h http.Handler = IngestHandlerNew(func(ctx context.Context, many s2k.Iter[sp.TsSample]) error {
+			calls += 1
+			return r.BatchSet(ctx, many)
+		}, WithBatchSize(2))
+		body := []byte(`[
+			{"id":"cafef00d","date":"2022-08-26T13:14:15Z"},
+			{"id":"cafef00d","date":"2022-08-26T13:14:16Z"},
+			{"id":"cafef00d","date":"2022-08-26T13:14:17Z"},
+			{"id":"cafef00d","date":"2022-08-26T13:14:18Z"},
+			{"id":"cafef00d","date":"2022-08-26T13:14:19Z"}
+		]`)
+		rec, result := post(t, h, ContentTypeJson, body)
+		checker(t, rec.Code, http.StatusOK)
+		checker(t, result.Accepted, 5)
+		checker(t, len(r.samples), 5)
+		checker(t, calls, 3)
+	})
+
+	t.Run("custom validator", func(t *testing.T) {
+		t.Parallel()
+
+		var r recorder
+		var h http.Handler = IngestHandlerNew(r.BatchSet, WithIdValidator(func(id string) error {
+			if "cafef00d" != id {
+				return fmt.Errorf("Unknown device: %s", id)
+			}
+			return nil
+		}))
+		body := []byte(`[
+			{"id":"cafef00d","date":"2022-08-26T13:14:15Z"},
+			{"id":"deadbeaf","date":"2022-08-26T13:14:15Z"}
+		]`)
+		_, result := post(t, h, ContentTypeJson, body)
+		checker(t, result.Accepted, 1)
+		checker(t, result.Errors[0], "Unknown device: deadbeaf")
+	})
+}
@@ -0,0 +1,357 @@
+package httpd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	tscsv "github.com/takanoriyanagitani/go-spacetimedb/csv"
+	vlcb "github.com/takanoriyanagitani/go-spacetimedb/vlog/cbor"
+)
+
+const (
+	ContentTypeJsonLines = "application/x-ndjson"
+	ContentTypeCsv       = "text/csv"
+
+	// NextTokenHeader has the token of the next page of samples(empty: last page).
+	NextTokenHeader = "X-Next-Token"
+
+	defaultLimit int = 1000
+	maxLimit     int = 10000
+
+	defaultMaxSpan time.Duration = 366 * 24 * time.Hour
+)
+
+// Catalog lists devices and partitions(e.g. stdb.Catalog, *stdb.PgPartitioned).
+type Catalog interface {
+	Devices(ctx context.Context) ([]string, error)
+	DatesOf(ctx context.Context, id string) ([]string, error)
+	DevicesOn(ctx context.Context, label string) ([]string, error)
+}
+
+// ListResult is the response body of list endpoints.
+type ListResult struct {
+	Items []string `json:"items"`
+	Next  string   `json:"next,omitempty"`
+}
+
+type sampleWriter func(w http.ResponseWriter, samples []sp.TsSample) error
+
+var sampleWriters map[string]sampleWriter = map[string]sampleWriter{
+	ContentTypeJsonLines: writeJsonLines,
+	ContentTypeCbor:      writeCbor,
+	ContentTypeCsv:       writeCsv,
+}
+
+// in the order of preference for wildcards
+var sampleTypes []string = []string{ContentTypeJsonLines, ContentTypeCbor, ContentTypeCsv}
+
+func sampleDto(s sp.TsSample) (dto vlcb.SampleDto) {
+	s.ForUser(&dto)
+	return
+}
+
+func writeJsonLines(w http.ResponseWriter, samples []sp.TsSample) error {
+	enc := json.NewEncoder(w)
+	for _, s := range samples {
+		e := enc.Encode(sp.JsonSample(sampleDto(s)))
+		if nil != e {
+			return e
+		}
+	}
+	return nil
+}
+
+func writeCbor(w http.ResponseWriter, samples []sp.TsSample) error {
+	packed, e := vlcb.CborVlogNew().Pack(samples)
+	if nil != e {
+		return e
+	}
+	_, e = w.Write(packed)
+	return e
+}
+
+// writeCsv writes id, date(RFC3339), key(base64), val(base64).
+func writeCsv(w http.ResponseWriter, samples []sp.TsSample) error {
+	return tscsv.WriteCsv(w, s2k.IterFromArray(samples))
+}
+
+type accepted struct {
+	mediaType string
+	q         float64
+}
+
+// negotiate chooses the content type of samples using the Accept header.
+// JSON Lines will be used if the header is missing.
+func negotiate(accept string) (string, bool) {
+	if "" == accept {
+		return ContentTypeJsonLines, true
+	}
+	var candidates []accepted
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, e := mime.ParseMediaType(strings.TrimSpace(part))
+		if nil != e {
+			continue
+		}
+		var q float64 = 1
+		if qs, ok := params["q"]; ok {
+			q, e = strconv.ParseFloat(qs, 64)
+			if nil != e {
+				continue
+			}
+		}
+		if 0 < q {
+			candidates = append(candidates, accepted{mediaType, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	for _, c := range candidates {
+		if _, ok := sampleWriters[c.mediaType]; ok {
+			return c.mediaType, true
+		}
+		for _, t := range sampleTypes {
+			if "*/*" == c.mediaType || strings.Split(t, "/")[0]+"/*" == c.mediaType {
+				return t, true
+			}
+		}
+	}
+	return "", false
+}
+
+func encodeToken(raw []byte) string { return base64.RawURLEncoding.EncodeToString(raw) }
+
+func decodeToken(token string) ([]byte, error) {
+	raw, e := base64.RawURLEncoding.DecodeString(token)
+	if nil != e {
+		return nil, fmt.Errorf("Invalid token: %v", e)
+	}
+	return raw, nil
+}
+
+// sampleToken encodes the position of the sample(partition start, key).
+// The next page is read from the partition of the position.
+func sampleToken(s sp.TsSample) string {
+	var dto vlcb.SampleDto = sampleDto(s)
+	raw := binary.BigEndian.AppendUint64(nil, uint64(dto.Date.UnixNano()))
+	return encodeToken(append(raw, dto.Key...))
+}
+
+// after checks if the sample is after the position of the token.
+func after(s sp.TsSample, raw []byte) bool {
+	var dto vlcb.SampleDto = sampleDto(s)
+	var date int64 = int64(binary.BigEndian.Uint64(raw[:8]))
+	var unix int64 = dto.Date.UnixNano()
+	if unix != date {
+		return date < unix
+	}
+	return 0 < bytes.Compare(dto.Key, raw[8:])
+}
+
+func parseLimit(r *http.Request) (int, error) {
+	var s string = r.URL.Query().Get("limit")
+	if "" == s {
+		return defaultLimit, nil
+	}
+	limit, e := strconv.Atoi(s)
+	if nil != e || limit < 1 || maxLimit < limit {
+		return 0, fmt.Errorf("Invalid limit: %s", s)
+	}
+	return limit, nil
+}
+
+// pageStrings gets at most limit items after the token(items must be sorted).
+func pageStrings(items []string, token string, limit int) (ListResult, error) {
+	var start int = 0
+	if "" != token {
+		raw, e := decodeToken(token)
+		if nil != e {
+			return ListResult{}, e
+		}
+		start = sort.SearchStrings(items, string(raw))
+		if start < len(items) && items[start] == string(raw) {
+			start += 1
+		}
+	}
+	var page []string = items[start:]
+	var result ListResult = ListResult{Items: []string{}}
+	if limit < len(page) {
+		page = page[:limit]
+		result.Next = encodeToken([]byte(page[limit-1]))
+	}
+	result.Items = append(result.Items, page...)
+	return result, nil
+}
+
+type queryHandler struct {
+	scan    sp.RangeScan
+	maxSpan time.Duration
+}
+
+type QueryOption func(q *queryHandler)
+
+// WithMaxSpan limits end - start of sample queries.
+func WithMaxSpan(d time.Duration) QueryOption {
+	return func(q *queryHandler) { q.maxSpan = d }
+}
+
+// validPath rejects path values which can not be a part of bucket names.
+func validPath(w http.ResponseWriter, r *http.Request, name string) bool {
+	e := sp.DefaultIdValidator(r.PathValue(name))
+	if nil != e {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (q queryHandler) list(w http.ResponseWriter, r *http.Request, lister func(context.Context) ([]string, error)) {
+	limit, e := parseLimit(r)
+	if nil != e {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	items, e := lister(r.Context())
+	if nil != e {
+		http.Error(w, fmt.Sprintf("Unable to list: %v", e), http.StatusInternalServerError)
+		return
+	}
+	sort.Strings(items)
+	result, e := pageStrings(items, r.URL.Query().Get("token"), limit)
+	if nil != e {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJson(w, http.StatusOK, result)
+}
+
+func parseTime(r *http.Request, name string) (time.Time, error) {
+	var s string = r.URL.Query().Get(name)
+	t, e := time.Parse(time.RFC3339Nano, s)
+	if nil != e {
+		return t, fmt.Errorf("Invalid %s: %q", name, s)
+	}
+	return t, nil
+}
+
+func (q queryHandler) samples(w http.ResponseWriter, r *http.Request) {
+	if !validPath(w, r, "id") {
+		return
+	}
+	contentType, ok := negotiate(r.Header.Get("Accept"))
+	if !ok {
+		http.Error(w, "Not acceptable", http.StatusNotAcceptable)
+		return
+	}
+	limit, e := parseLimit(r)
+	if nil != e {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	start, e := parseTime(r, "start")
+	if nil != e {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	end, e := parseTime(r, "end")
+	if nil != e {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.maxSpan < end.Sub(start) {
+		http.Error(w, fmt.Sprintf("Too long range(max: %v)", q.maxSpan), http.StatusBadRequest)
+		return
+	}
+	var pos []byte
+	var from time.Time = start
+	if token := r.URL.Query().Get("token"); "" != token {
+		pos, e = decodeToken(token)
+		if nil == e && len(pos) < 8 {
+			e = fmt.Errorf("Invalid token: %s", token)
+		}
+		if nil != e {
+			http.Error(w, e.Error(), http.StatusBadRequest)
+			return
+		}
+		// partitions before the partition of the token were read by previous pages
+		var partition time.Time = time.Unix(0, int64(binary.BigEndian.Uint64(pos[:8]))).UTC()
+		if partition.After(from) {
+			from = partition
+		}
+	}
+
+	var page []sp.TsSample
+	var more bool = false
+	e = q.scan(r.Context(), r.PathValue("id"), from, end, func(partition []sp.TsSample) bool {
+		for _, s := range partition {
+			if nil != pos && !after(s, pos) {
+				continue
+			}
+			if limit == len(page) {
+				more = true
+				return false
+			}
+			page = append(page, s)
+		}
+		return true
+	})
+	if nil != e {
+		http.Error(w, fmt.Sprintf("Unable to read: %v", e), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if more {
+		w.Header().Set(NextTokenHeader, sampleToken(page[len(page)-1]))
+	}
+	w.WriteHeader(http.StatusOK)
+	_ = sampleWriters[contentType](w, page) // unable to report errors after the header
+}
+
+// QueryHandlerNew creates a handler for read endpoints.
+//
+//	GET /devices                       devices(ListResult)
+//	GET /devices/{id}/dates            partitions of the device(ListResult)
+//	GET /dates/{date}/devices          devices of the partition(ListResult)
+//	GET /devices/{id}/samples?start=&end=
+//	                                   samples in partitions which overlap [start, end)(RFC3339)
+//
+// All endpoints accept limit and token(the next token of the previous page).
+// Samples are written as JSON Lines, CBOR or CSV using the Accept header.
+// Sample queries longer than the max span(default: 366 days) are rejected.
+// Partitions are scanned only until the page is full(see sp.RangeRead.AsRangeScan for other readers).
+func QueryHandlerNew(cat Catalog, scan sp.RangeScan, opts ...QueryOption) http.Handler {
+	q := queryHandler{scan: scan, maxSpan: defaultMaxSpan}
+	for _, opt := range opts {
+		opt(&q)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices", func(w http.ResponseWriter, r *http.Request) {
+		q.list(w, r, cat.Devices)
+	})
+	mux.HandleFunc("GET /devices/{id}/dates", func(w http.ResponseWriter, r *http.Request) {
+		if !validPath(w, r, "id") {
+			return
+		}
+		q.list(w, r, func(ctx context.Context) ([]string, error) { return cat.DatesOf(ctx, r.PathValue("id")) })
+	})
+	mux.HandleFunc("GET /dates/{date}/devices", func(w http.ResponseWriter, r *http.Request) {
+		if !validPath(w, r, "date") {
+			return
+		}
+		q.list(w, r, func(ctx context.Context) ([]string, error) { return cat.DevicesOn(ctx, r.PathValue("date")) })
+	})
+	mux.HandleFunc("GET /devices/{id}/samples", q.samples)
+	return mux
+}
@@ -0,0 +1,285 @@
+package httpd
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	vlcb "github.com/takanoriyanagitani/go-spacetimedb/vlog/cbor"
+)
+
+type memKv struct {
+	lk      sync.Mutex
+	buckets map[string]map[string][]byte
+}
+
+func (m *memKv) AddBucket(_ context.Context, bucket string) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	if _, ok := m.buckets[bucket]; !ok {
+		m.buckets[bucket] = make(map[string][]byte)
+	}
+	return nil
+}
+
+func (m *memKv) SetBatch(_ context.Context, many s2k.Iter[s2k.Batch]) error {
+	for o := many(); o.HasValue(); o = many() {
+		var b s2k.Batch = o.Value()
+		m.lk.Lock()
+		bucket, ok := m.buckets[b.Bucket()]
+		if ok {
+			bucket[string(b.Pair().Key)] = b.Pair().Val
+		}
+		m.lk.Unlock()
+		if !ok {
+			return fmt.Errorf("No such bucket: %s", b.Bucket())
+		}
+	}
+	return nil
+}
+
+func (m *memKv) Get(_ context.Context, bucket string, key []byte) ([]byte, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	return m.buckets[bucket][string(key)], nil
+}
+
+func (m *memKv) Lst(_ context.Context, bucket string, cb func(key []byte) error) error {
+	m.lk.Lock()
+	b, ok := m.buckets[bucket]
+	var keys []string
+	for k := range b {
+		keys = append(keys, k)
+	}
+	m.lk.Unlock()
+	if !ok {
+		return fmt.Errorf("No such bucket: %s", bucket)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e := cb([]byte(k))
+		if nil != e {
+			return e
+		}
+	}
+	return nil
+}
+
+func get(t *testing.T, h http.Handler, target string, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if "" != accept {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func getList(t *testing.T, h http.Handler, target string) (result ListResult) {
+	t.Helper()
+	rec := get(t, h, target, "")
+	checker(t, rec.Code, http.StatusOK)
+	e := json.Unmarshal(rec.Body.Bytes(), &result)
+	if nil != e {
+		t.Fatalf("Invalid response: %v", e)
+	}
+	return
+}
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 0, time.UTC)
+
+	kv := &memKv{buckets: make(map[string]map[string][]byte)}
+	e := sp.NewBatchSetter(kv.AddBucket, kv.SetBatch, 1024)(sp.YmdConverter)(context.Background(), s2k.IterFromArray([]sp.TsSample{
+		sp.TsSampleNew("cafef00d", dt, []byte("k0"), []byte("v0")),
+		sp.TsSampleNew("cafef00d", dt, []byte("k1"), []byte("v1")),
+		sp.TsSampleNew("cafef00d", dt.AddDate(0, 0, 1), []byte("k0"), []byte("v2")),
+		sp.TsSampleNew("deadbeaf", dt, []byte("k0"), []byte("v3")),
+		sp.TsSampleNew("face8642", dt, []byte("k0"), []byte("v4")),
+	}))
+	if nil != e {
+		t.Fatalf("Unable to set: %v", e)
+	}
+
+	var h http.Handler = QueryHandlerNew(
+		sp.CatalogNew(kv.Lst),
+		sp.NewRangeScanner(kv.Lst, kv.Get)(sp.DayPartitioner),
+	)
+
+	t.Run("devices", func(t *testing.T) {
+		t.Parallel()
+
+		first := getList(t, h, "/devices?limit=2")
+		checker(t, len(first.Items), 2)
+		checker(t, first.Items[1], "deadbeaf")
+
+		second := getList(t, h, "/devices?limit=2&token="+first.Next)
+		checker(t, len(second.Items), 1)
+		checker(t, second.Items[0], "face8642")
+		checker(t, second.Next, "")
+	})
+
+	t.Run("dates of device", func(t *testing.T) {
+		t.Parallel()
+
+		result := getList(t, h, "/devices/cafef00d/dates")
+		checker(t, len(result.Items), 2)
+		checker(t, result.Items[0], "20220826")
+	})
+
+	t.Run("devices of date", func(t *testing.T) {
+		t.Parallel()
+
+		result := getList(t, h, "/dates/20220826/devices")
+		checker(t, len(result.Items), 3)
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		t.Parallel()
+
+		rec := get(t, h, "/devices/DROP%20TABLE/dates", "")
+		checker(t, rec.Code, http.StatusBadRequest)
+	})
+
+	const samples = "/devices/cafef00d/samples?start=2022-08-26T00:00:00Z&end=2022-08-28T00:00:00Z"
+
+	t.Run("samples json lines pages", func(t *testing.T) {
+		t.Parallel()
+
+		var vals []string
+		var token string = ""
+		for i := 0; i < 3; i++ {
+			rec := get(t, h, samples+"&limit=2&token="+token, "")
+			checker(t, rec.Code, http.StatusOK)
+			checker(t, rec.Header().Get("Content-Type"), ContentTypeJsonLines)
+
+			dec := json.NewDecoder(rec.Body)
+			for dec.More() {
+				var s sp.JsonSample
+				e := dec.Decode(&s)
+				if nil != e {
+					t.Fatalf("Invalid line: %v", e)
+				}
+				vals = append(vals, string(s.Val))
+			}
+			token = rec.Header().Get(NextTokenHeader)
+			if "" == token {
+				break
+			}
+		}
+		checker(t, fmt.Sprint(vals), "[v0 v1 v2]")
+	})
+
+	t.Run("samples cbor", func(t *testing.T) {
+		t.Parallel()
+
+		rec := get(t, h, samples, "text/html;q=0.9, application/cbor")
+		checker(t, rec.Header().Get("Content-Type"), ContentTypeCbor)
+		unpacked, e := vlcb.CborVlogNew().Unpack(rec.Body.Bytes())
+		if nil != e {
+			t.Fatalf("Unable to unpack: %v", e)
+		}
+		checker(t, len(unpacked), 3)
+	})
+
+	t.Run("samples csv", func(t *testing.T) {
+		t.Parallel()
+
+		rec := get(t, h, samples, "text/*")
+		checker(t, rec.Header().Get("Content-Type"), ContentTypeCsv)
+		rows, e := csv.NewReader(bytes.NewReader(rec.Body.Bytes())).ReadAll()
+		if nil != e {
+			t.Fatalf("Invalid csv: %v", e)
+		}
+		checker(t, len(rows), 4)
+		checker(t, rows[1][3], "djA=")
+	})
+
+	t.Run("not acceptable", func(t *testing.T) {
+		t.Parallel()
+
+		rec := get(t, h, samples, "text/html")
+		checker(t, rec.Code, http.StatusNotAcceptable)
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		t.Parallel()
+
+		rec := get(t, h, "/devices/cafef00d/samples?start=yesterday", "")
+		checker(t, rec.Code, http.StatusBadRequest)
+
+		rec = get(t, h, "/devices/cafef00d/samples?start=0022-08-26T00:00:00Z&end=2022-08-28T00:00:00Z", "")
+		checker(t, rec.Code, http.StatusBadRequest)
+
+		var short http.Handler = QueryHandlerNew(
+			sp.CatalogNew(kv.Lst),
+			sp.NewRangeScanner(kv.Lst, kv.Get)(sp.DayPartitioner),
+			WithMaxSpan(24*time.Hour),
+		)
+		rec = get(t, short, samples, "")
+		checker(t, rec.Code, http.StatusBadRequest)
+	})
+
+	t.Run("samples resumed from the partition of the token", func(t *testing.T) {
+		t.Parallel()
+
+		var starts []time.Time
+		var scan sp.RangeScan = sp.NewRangeScanner(kv.Lst, kv.Get)(sp.DayPartitioner)
+		var h http.Handler = QueryHandlerNew(
+			sp.CatalogNew(kv.Lst),
+			func(ctx context.Context, id string, start, end time.Time, f func(partition []sp.TsSample) bool) error {
+				starts = append(starts, start)
+				return scan(ctx, id, start, end, f)
+			},
+		)
+
+		var next time.Time = time.Date(2022, time.August, 27, 0, 0, 0, 0, time.UTC)
+		var token string = sampleToken(sp.TsSampleNew("cafef00d", next, []byte("k"), nil))
+		rec := get(t, h, samples+"&token="+token, "")
+		checker(t, rec.Code, http.StatusOK)
+		checker(t, len(starts), 1)
+		checker(t, starts[0].Equal(next), true)
+
+		var s sp.JsonSample
+		e := json.Unmarshal(rec.Body.Bytes(), &s)
+		if nil != e {
+			t.Fatalf("Invalid line: %v", e)
+		}
+		checker(t, string(s.Val), "v2") // (20220827, k0) is after (20220827, k)
+	})
+
+	t.Run("samples scanned until the page is full", func(t *testing.T) {
+		t.Parallel()
+
+		var partitions int
+		var scan sp.RangeScan = sp.NewRangeScanner(kv.Lst, kv.Get)(sp.DayPartitioner)
+		var h http.Handler = QueryHandlerNew(
+			sp.CatalogNew(kv.Lst),
+			func(ctx context.Context, id string, start, end time.Time, f func(partition []sp.TsSample) bool) error {
+				return scan(ctx, id, start, end, func(partition []sp.TsSample) bool {
+					partitions += 1
+					return f(partition)
+				})
+			},
+		)
+
+		rec := get(t, h, samples+"&limit=1", "")
+		checker(t, rec.Code, http.StatusOK)
+		checker(t, rec.Header().Get(NextTokenHeader) != "", true)
+		checker(t, partitions, 1) // 20220826 has 2 samples
+	})
+}
@@ -0,0 +1,29 @@
+package stdb
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// ids are used as a part of bucket names(data_<date>_<id>)
+var idPattern *regexp.Regexp = regexp.MustCompile(`^[0-9a-z_]{1,40}$`)
+
+// IdValidator rejects ids which can not be stored.
+type IdValidator func(id string) error
+
+// DefaultIdValidator accepts ids which can be a part of bucket names.
+func DefaultIdValidator(id string) error {
+	if !idPattern.MatchString(id) {
+		return fmt.Errorf("Invalid id: %q", id)
+	}
+	return nil
+}
+
+// JsonSample is a sample in json(key/val: base64).
+type JsonSample struct {
+	Id   string    `json:"id"`
+	Date time.Time `json:"date"`
+	Key  []byte    `json:"key"`
+	Val  []byte    `json:"val"`
+}
@@ -0,0 +1,17 @@
+package stdb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultIdValidator(t *testing.T) {
+	t.Parallel()
+
+	checker(nil, DefaultIdValidator("cafef00d_42"), t)
+	for _, id := range []string{"", "DROP TABLE", "a-b", strings.Repeat("a", 41)} {
+		if nil == DefaultIdValidator(id) {
+			t.Errorf("Must fail: %q", id)
+		}
+	}
+}
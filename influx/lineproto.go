@@ -0,0 +1,241 @@
+// Package influx converts InfluxDB line protocol to samples.
+package influx
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Field value is one of float64, int64, uint64, string or bool.
+type Field struct {
+	Key   string
+	Value any
+}
+
+type Point struct {
+	Measurement string
+	Tags        []Tag // sorted by key
+	Fields      []Field
+	Time        time.Time
+}
+
+// Tag gets the value of the tag.
+func (p Point) Tag(key string) (string, bool) {
+	for _, t := range p.Tags {
+		if key == t.Key {
+			return t.Value, true
+		}
+	}
+	return "", false
+}
+
+// Precision gets the unit of timestamps(n, ns, u, us, ms, s). Empty means ns.
+func Precision(name string) (time.Duration, error) {
+	switch name {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	}
+	return 0, fmt.Errorf("Invalid precision: %s", name)
+}
+
+type lineScanner struct {
+	line []byte
+	pos  int
+}
+
+func (s *lineScanner) done() bool { return len(s.line) <= s.pos }
+func (s *lineScanner) peek() byte { return s.line[s.pos] }
+
+// token reads until one of the stops(unescaped).
+// Backslash escapes the following character if it is one of the escapable characters.
+func (s *lineScanner) token(stops string, escapable string) string {
+	var buf strings.Builder
+	for !s.done() {
+		var c byte = s.peek()
+		if '\\' == c && s.pos+1 < len(s.line) && 0 <= strings.IndexByte(escapable, s.line[s.pos+1]) {
+			buf.WriteByte(s.line[s.pos+1])
+			s.pos += 2
+			continue
+		}
+		if 0 <= strings.IndexByte(stops, c) {
+			break
+		}
+		buf.WriteByte(c)
+		s.pos += 1
+	}
+	return buf.String()
+}
+
+func (s *lineScanner) expect(c byte) error {
+	if s.done() || c != s.peek() {
+		return fmt.Errorf("Expected %q at %d", c, s.pos)
+	}
+	s.pos += 1
+	return nil
+}
+
+func (s *lineScanner) quoted() (string, error) {
+	e := s.expect('"')
+	if nil != e {
+		return "", e
+	}
+	var buf strings.Builder
+	for !s.done() {
+		var c byte = s.peek()
+		switch {
+		case '\\' == c && s.pos+1 < len(s.line) && ('"' == s.line[s.pos+1] || '\\' == s.line[s.pos+1]):
+			buf.WriteByte(s.line[s.pos+1])
+			s.pos += 2
+		case '"' == c:
+			s.pos += 1
+			return buf.String(), nil
+		default:
+			buf.WriteByte(c)
+			s.pos += 1
+		}
+	}
+	return "", fmt.Errorf("Unterminated string")
+}
+
+func parseValue(raw string) (any, error) {
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	case "":
+		return nil, fmt.Errorf("Missing field value")
+	}
+	switch raw[len(raw)-1] {
+	case 'i':
+		return strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+	case 'u':
+		return strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+	}
+	return strconv.ParseFloat(raw, 64)
+}
+
+const (
+	escMeasurement = ", \\"
+	escKey         = ",= \\"
+)
+
+// ParseLine parses a line(without the line feed).
+// The time will be now if the line has no timestamp.
+func ParseLine(line []byte, precision time.Duration, now time.Time) (p Point, e error) {
+	s := &lineScanner{line: line}
+
+	p.Measurement = s.token(", ", escMeasurement)
+	if "" == p.Measurement {
+		return p, fmt.Errorf("Missing measurement")
+	}
+
+	for !s.done() && ',' == s.peek() {
+		s.pos += 1
+		var t Tag
+		t.Key = s.token("= ,", escKey)
+		e = s.expect('=')
+		if nil != e {
+			return
+		}
+		t.Value = s.token(", ", escKey)
+		if "" == t.Key || "" == t.Value {
+			return p, fmt.Errorf("Invalid tag: %q=%q", t.Key, t.Value)
+		}
+		p.Tags = append(p.Tags, t)
+	}
+	sort.SliceStable(p.Tags, func(i, j int) bool { return p.Tags[i].Key < p.Tags[j].Key })
+
+	e = s.expect(' ')
+	if nil != e {
+		return p, fmt.Errorf("Missing fields")
+	}
+
+	for {
+		var f Field
+		f.Key = s.token("= ,", escKey)
+		e = s.expect('=')
+		if nil != e || "" == f.Key {
+			return p, fmt.Errorf("Invalid field: %q", f.Key)
+		}
+		if !s.done() && '"' == s.peek() {
+			f.Value, e = s.quoted()
+		} else {
+			f.Value, e = parseValue(s.token(", ", ""))
+		}
+		if nil != e {
+			return p, fmt.Errorf("Invalid field(%s): %v", f.Key, e)
+		}
+		p.Fields = append(p.Fields, f)
+		if s.done() || ',' != s.peek() {
+			break
+		}
+		s.pos += 1
+	}
+
+	p.Time = now
+	if s.done() {
+		return p, nil
+	}
+	e = s.expect(' ')
+	if nil != e {
+		return
+	}
+	var raw string = strings.TrimSpace(string(s.line[s.pos:]))
+	if "" == raw {
+		return p, nil
+	}
+	ts, e := strconv.ParseInt(raw, 10, 64)
+	if nil != e {
+		return p, fmt.Errorf("Invalid timestamp: %s", raw)
+	}
+	if ts < math.MinInt64/int64(precision) || math.MaxInt64/int64(precision) < ts {
+		return p, fmt.Errorf("Timestamp out of range: %s", raw)
+	}
+	p.Time = time.Unix(0, ts*int64(precision)).UTC()
+	return p, nil
+}
+
+// LineError is an error of a line.
+type LineError struct {
+	Line int // 1-origin
+	Err  error
+}
+
+func (l LineError) Error() string { return fmt.Sprintf("line %d: %v", l.Line, l.Err) }
+func (l LineError) Unwrap() error { return l.Err }
+
+// Parse parses all lines. Empty lines and comments are skipped.
+// Invalid lines are reported as LineErrors(other lines are parsed).
+func Parse(body []byte, precision time.Duration, now time.Time) (points []Point, errs []LineError) {
+	for i, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		var trimmed []byte = bytes.TrimSpace(line)
+		if 0 == len(trimmed) || '#' == trimmed[0] {
+			continue
+		}
+		p, e := ParseLine(bytes.TrimLeft(line, " \t"), precision, now)
+		if nil != e {
+			errs = append(errs, LineError{Line: i + 1, Err: e})
+			continue
+		}
+		points = append(points, p)
+	}
+	return
+}
@@ -0,0 +1,107 @@
+package influx
+
+import (
+	"testing"
+	"time"
+)
+
+func checker[T comparable](t *testing.T, got T, expected T) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("Unexpected value got.\n")
+		t.Errorf("expected: %v\n", expected)
+		t.Errorf("got:      %v\n", got)
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	t.Parallel()
+
+	var now time.Time = time.Date(2022, time.August, 26, 0, 0, 0, 0, time.UTC)
+
+	t.Run("full", func(t *testing.T) {
+		t.Parallel()
+
+		p, e := ParseLine(
+			[]byte(`cpu\ load,region=us\,west,host=server01 value=0.64,count=3i,big=18446744073709551615u,up=t,msg="say \"hi\", ok" 1661472000000000000`),
+			time.Nanosecond,
+			now,
+		)
+		if nil != e {
+			t.Fatalf("Unable to parse: %v", e)
+		}
+		checker(t, p.Measurement, "cpu load")
+		checker(t, len(p.Tags), 2)
+		checker(t, p.Tags[0].Key, "host")
+		checker(t, p.Tags[1].Value, "us,west")
+		checker(t, len(p.Fields), 5)
+		checker[any](t, p.Fields[0].Value, 0.64)
+		checker[any](t, p.Fields[1].Value, int64(3))
+		checker[any](t, p.Fields[2].Value, uint64(18446744073709551615))
+		checker[any](t, p.Fields[3].Value, true)
+		checker[any](t, p.Fields[4].Value, `say "hi", ok`)
+		checker(t, p.Time.Equal(now), true)
+	})
+
+	t.Run("no tags no timestamp", func(t *testing.T) {
+		t.Parallel()
+
+		p, e := ParseLine([]byte(`mem free=1024i`), time.Nanosecond, now)
+		if nil != e {
+			t.Fatalf("Unable to parse: %v", e)
+		}
+		checker(t, len(p.Tags), 0)
+		checker(t, p.Time, now)
+	})
+
+	t.Run("precision", func(t *testing.T) {
+		t.Parallel()
+
+		precision, e := Precision("s")
+		if nil != e {
+			t.Fatalf("Unable to get precision: %v", e)
+		}
+		p, e := ParseLine([]byte(`mem free=1 1661472000`), precision, time.Time{})
+		if nil != e {
+			t.Fatalf("Unable to parse: %v", e)
+		}
+		checker(t, p.Time.Equal(now), true)
+
+		for _, line := range []string{
+			`mem free=1 9223372036854775807`,
+			`mem free=1 -9223372036854775808`,
+		} {
+			_, e = ParseLine([]byte(line), precision, time.Time{})
+			if nil == e {
+				t.Errorf("Must fail(overflow): %s", line)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		for _, line := range []string{
+			`cpu`,
+			`cpu,host value=1`,
+			`cpu value=`,
+			`cpu value=abc`,
+			`cpu value="open`,
+			`cpu value=1 yesterday`,
+		} {
+			_, e := ParseLine([]byte(line), time.Nanosecond, now)
+			if nil == e {
+				t.Errorf("Must fail: %s", line)
+			}
+		}
+	})
+
+	t.Run("Parse", func(t *testing.T) {
+		t.Parallel()
+
+		points, errs := Parse([]byte("# comment\n\ncpu value=1\r\ncpu value=\nmem free=2i\n"), time.Nanosecond, now)
+		checker(t, len(points), 2)
+		checker(t, len(errs), 1)
+		checker(t, errs[0].Line, 4)
+	})
+}
@@ -0,0 +1,228 @@
+package influx
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	tskey "github.com/takanoriyanagitani/go-spacetimedb/key"
+)
+
+const (
+	defaultMaxBytes  int64 = 16 << 20
+	defaultBatchSize int   = 1024
+)
+
+// IdMapper gets the device id of the point.
+type IdMapper func(p Point) (string, error)
+
+// SampleMapper converts the point to samples of the device.
+type SampleMapper func(id string, p Point) ([]sp.TsSample, error)
+
+// HashIdMapper uses the hash of the series(measurement and tags) as the id(32 hex digits).
+func HashIdMapper(p Point) (string, error) {
+	h := sha256.New()
+	_, _ = io.WriteString(h, p.Measurement)
+	for _, t := range p.Tags {
+		_, _ = fmt.Fprintf(h, "\x00%s\x00%s", t.Key, t.Value)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+// TagIdMapper uses the value of the tag(e.g. host) as the id.
+func TagIdMapper(key string) IdMapper {
+	return func(p Point) (string, error) {
+		val, ok := p.Tag(key)
+		if !ok {
+			return "", fmt.Errorf("Missing tag: %s", key)
+		}
+		return val, nil
+	}
+}
+
+// FieldMapper creates a sample for each field.
+//
+//	key: (time, measurement, field key) encoded by tskey.Tuple
+//	val: the field value encoded by cbor
+func FieldMapper(id string, p Point) ([]sp.TsSample, error) {
+	var prefix tskey.Tuple = tskey.TupleNew().Time(p.Time).String(p.Measurement)
+	samples := make([]sp.TsSample, 0, len(p.Fields))
+	for _, f := range p.Fields {
+		val, e := cbor.Marshal(f.Value)
+		if nil != e {
+			return nil, e
+		}
+		var key tskey.Tuple = prefix.String(f.Key)
+		samples = append(samples, sp.TsSampleNew(id, p.Time, key.AsKey(), val))
+	}
+	return samples, nil
+}
+
+// FieldSetMapper creates a sample for each point.
+//
+//	key: (time, measurement) encoded by tskey.Tuple
+//	val: the field set encoded by cbor(a map)
+func FieldSetMapper(id string, p Point) ([]sp.TsSample, error) {
+	fields := make(map[string]any, len(p.Fields))
+	for _, f := range p.Fields {
+		fields[f.Key] = f.Value
+	}
+	val, e := cbor.Marshal(fields)
+	if nil != e {
+		return nil, e
+	}
+	var key tskey.Tuple = tskey.TupleNew().Time(p.Time).String(p.Measurement)
+	return []sp.TsSample{sp.TsSampleNew(id, p.Time, key.AsKey(), val)}, nil
+}
+
+// Mapping converts points to samples.
+type Mapping struct {
+	Id      IdMapper
+	Samples SampleMapper
+}
+
+var DefaultMapping Mapping = Mapping{Id: HashIdMapper, Samples: FieldMapper}
+
+type writeConfig struct {
+	mapping   Mapping
+	validate  func(id string) error
+	maxBytes  int64
+	batchSize int
+	now       func() time.Time
+}
+
+type WriteOption func(c *writeConfig)
+
+func WithMapping(m Mapping) WriteOption {
+	return func(c *writeConfig) { c.mapping = m }
+}
+
+// WithIdValidator rejects points of invalid devices(default: sp.DefaultIdValidator, nil: no validation).
+func WithIdValidator(v func(id string) error) WriteOption {
+	return func(c *writeConfig) { c.validate = v }
+}
+
+func WithMaxBytes(n int64) WriteOption {
+	return func(c *writeConfig) { c.maxBytes = n }
+}
+
+// WithBatchSize limits the number of samples written by a BatchSet call(default: 1024).
+// The limit of the batch setter must be sp.BatchesPerSample times the size or more.
+func WithBatchSize(n int) WriteOption {
+	return func(c *writeConfig) { c.batchSize = n }
+}
+
+// influx compatible error body
+type writeError struct {
+	Code    string `json:"code"`
+	Message string `json:"error"`
+}
+
+func writeErr(w http.ResponseWriter, status int, code string, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(writeError{Code: code, Message: msg})
+}
+
+func (c *writeConfig) convert(points []Point) (samples []sp.TsSample, rejected []string) {
+	for _, p := range points {
+		id, e := c.mapping.Id(p)
+		if nil == e && nil != c.validate {
+			e = c.validate(id)
+		}
+		var converted []sp.TsSample
+		if nil == e {
+			converted, e = c.mapping.Samples(id, p)
+		}
+		if nil != e {
+			rejected = append(rejected, fmt.Sprintf("%s: %v", p.Measurement, e))
+			continue
+		}
+		samples = append(samples, converted...)
+	}
+	return
+}
+
+// WriteHandlerNew creates a handler compatible with the /write endpoint of InfluxDB.
+//
+// Query parameters other than precision(ns, us, ms, s) are ignored.
+// Valid points are written even if the body has invalid lines(400: partial write).
+func WriteHandlerNew(bset sp.BatchSet, opts ...WriteOption) http.Handler {
+	c := &writeConfig{
+		mapping:   DefaultMapping,
+		validate:  sp.DefaultIdValidator,
+		maxBytes:  defaultMaxBytes,
+		batchSize: defaultBatchSize,
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	var write sp.BatchSet = sp.ChunkedBatchSet(bset, c.batchSize)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodPost != r.Method {
+			w.Header().Set("Allow", http.MethodPost)
+			writeErr(w, http.StatusMethodNotAllowed, "method not allowed", "Method not allowed")
+			return
+		}
+		precision, e := Precision(r.URL.Query().Get("precision"))
+		if nil != e {
+			writeErr(w, http.StatusBadRequest, "invalid", e.Error())
+			return
+		}
+
+		var raw []byte
+		var body io.Reader = http.MaxBytesReader(w, r.Body, c.maxBytes)
+		if "gzip" == r.Header.Get("Content-Encoding") {
+			var gz *gzip.Reader
+			gz, e = gzip.NewReader(body)
+			if nil == e {
+				defer gz.Close()
+				body = io.LimitReader(gz, c.maxBytes+1) // decompressed size
+			}
+		}
+		if nil == e {
+			raw, e = io.ReadAll(body)
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(e, &tooLarge) || c.maxBytes < int64(len(raw)) {
+			writeErr(w, http.StatusRequestEntityTooLarge, "request too large", "Request body too large")
+			return
+		}
+		if nil != e {
+			writeErr(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Unable to read the body: %v", e))
+			return
+		}
+
+		points, errs := Parse(raw, precision, c.now().UTC())
+		samples, rejected := c.convert(points)
+		for _, le := range errs {
+			rejected = append(rejected, le.Error())
+		}
+
+		if 0 < len(samples) {
+			e = write(r.Context(), s2k.IterFromArray(samples))
+			if nil != e {
+				writeErr(w, http.StatusInternalServerError, "internal error", fmt.Sprintf("Unable to write: %v", e))
+				return
+			}
+		}
+		if 0 < len(rejected) {
+			writeErr(w, http.StatusBadRequest, "invalid", fmt.Sprintf("partial write: %v", rejected))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,174 @@
+package influx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	tskey "github.com/takanoriyanagitani/go-spacetimedb/key"
+	vlcb "github.com/takanoriyanagitani/go-spacetimedb/vlog/cbor"
+)
+
+type recorder struct {
+	samples []vlcb.SampleDto
+	writes  int
+}
+
+func (r *recorder) BatchSet(_ context.Context, many s2k.Iter[sp.TsSample]) error {
+	r.writes += 1
+	for o := many(); o.HasValue(); o = many() {
+		var dto vlcb.SampleDto
+		o.Value().ForUser(&dto)
+		r.samples = append(r.samples, dto)
+	}
+	return nil
+}
+
+func write(h http.Handler, target string, body []byte, gz bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if gz {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, _ = w.Write(body)
+		_ = w.Close()
+		req = httptest.NewRequest(http.MethodPost, target, &buf)
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 0, 0, 0, 0, time.UTC)
+
+	t.Run("default mapping", func(t *testing.T) {
+		t.Parallel()
+
+		var r recorder
+		rec := write(WriteHandlerNew(r.BatchSet), "/write?db=telegraf&precision=s", []byte(
+			"cpu,host=server01 usage=0.5,cores=8i 1661472000\n"+
+				"cpu,host=server02 usage=0.25 1661472000\n",
+		), true)
+		checker(t, rec.Code, http.StatusNoContent)
+		checker(t, len(r.samples), 3)
+		checker(t, r.samples[0].Id, r.samples[1].Id)
+		checker(t, r.samples[0].Id == r.samples[2].Id, false)
+		checker(t, len(r.samples[0].Id), 32)
+		checker(t, r.samples[0].Date.Equal(dt), true)
+
+		rdr := tskey.TupleReaderNew(r.samples[1].Key)
+		tm, _ := rdr.Time()
+		measurement, _ := rdr.String()
+		field, _ := rdr.String()
+		checker(t, tm.Equal(dt), true)
+		checker(t, measurement, "cpu")
+		checker(t, field, "cores")
+
+		var cores int64
+		e := cbor.Unmarshal(r.samples[1].Val, &cores)
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(t, cores, 8)
+	})
+
+	t.Run("batch size", func(t *testing.T) {
+		t.Parallel()
+
+		var r recorder
+		rec := write(WriteHandlerNew(r.BatchSet, WithBatchSize(2)), "/write?precision=s", []byte(
+			"cpu,host=server01 usage=0.5,cores=8i 1661472000\n"+
+				"cpu,host=server02 usage=0.25 1661472000\n",
+		), false)
+		checker(t, rec.Code, http.StatusNoContent)
+		checker(t, len(r.samples), 3)
+		checker(t, r.writes, 2)
+	})
+
+	t.Run("tag id and field set", func(t *testing.T) {
+		t.Parallel()
+
+		var r recorder
+		var h http.Handler = WriteHandlerNew(
+			r.BatchSet,
+			WithMapping(Mapping{Id: TagIdMapper("host"), Samples: FieldSetMapper}),
+			WithIdValidator(func(id string) error {
+				if strings.ToLower(id) != id {
+					return fmt.Errorf("Invalid id: %s", id)
+				}
+				return nil
+			}),
+		)
+		rec := write(h, "/write", []byte(
+			"cpu,host=server01 usage=0.5,cores=8i 1661472000000000000\n"+
+				"cpu usage=0.5 1661472000000000000\n"+
+				"cpu,host=SERVER usage=0.5 1661472000000000000\n"+
+				"cpu,host=server01 usage=\n",
+		), false)
+		checker(t, rec.Code, http.StatusBadRequest)
+		checker(t, strings.Contains(rec.Body.String(), "partial write"), true)
+		checker(t, len(r.samples), 1)
+		checker(t, r.samples[0].Id, "server01")
+
+		var fields map[string]any
+		e := cbor.Unmarshal(r.samples[0].Val, &fields)
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(t, len(fields), 2)
+	})
+
+	t.Run("default id validator", func(t *testing.T) {
+		t.Parallel()
+
+		var r recorder
+		var h http.Handler = WriteHandlerNew(r.BatchSet, WithMapping(Mapping{Id: TagIdMapper("host"), Samples: FieldSetMapper}))
+		rec := write(h, "/write", []byte(
+			"cpu,host=server01 usage=0.5\n"+
+				"cpu,host=DROP\\ TABLE usage=0.5\n",
+		), false)
+		checker(t, rec.Code, http.StatusBadRequest)
+		checker(t, len(r.samples), 1)
+	})
+
+	t.Run("invalid precision", func(t *testing.T) {
+		t.Parallel()
+
+		var r recorder
+		rec := write(WriteHandlerNew(r.BatchSet), "/write?precision=h", []byte("cpu usage=1"), false)
+		checker(t, rec.Code, http.StatusBadRequest)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		t.Parallel()
+
+		var r recorder
+		var h http.Handler = WriteHandlerNew(r.BatchSet, WithMaxBytes(8))
+		rec := write(h, "/write", []byte(strings.Repeat("cpu usage=1\n", 16)), true)
+		checker(t, rec.Code, http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		t.Parallel()
+
+		var h http.Handler = WriteHandlerNew(func(_ context.Context, _ s2k.Iter[sp.TsSample]) error {
+			return fmt.Errorf("Must fail")
+		})
+		rec := write(h, "/write", []byte("cpu usage=1"), false)
+		checker(t, rec.Code, http.StatusInternalServerError)
+	})
+}
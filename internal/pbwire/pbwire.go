@@ -0,0 +1,43 @@
+// Package pbwire provides protowire helpers shared by the hand-written protobuf codecs.
+package pbwire
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Consumer consumes the value of a field and returns its size(negative: protowire error).
+type Consumer func(num protowire.Number, typ protowire.Type, b []byte) (int, error)
+
+// ConsumeFields calls the consumer for each field. The consumer returns the size of the value.
+func ConsumeFields(b []byte, consumer Consumer) error {
+	for 0 < len(b) {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		n, e := consumer(num, typ, b)
+		if nil != e {
+			return e
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// ConsumeMessage calls the consumer with the embedded message if the field is a message.
+func ConsumeMessage(typ protowire.Type, b []byte, consumer func(msg []byte) error) (int, error) {
+	if protowire.BytesType != typ {
+		return -1, fmt.Errorf("Unexpected wire type: %v", typ)
+	}
+	msg, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return n, nil
+	}
+	return n, consumer(msg)
+}
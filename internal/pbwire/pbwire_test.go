@@ -0,0 +1,58 @@
+package pbwire
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func checker[T comparable](t *testing.T, got T, expected T) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("Unexpected value got.\n")
+		t.Errorf("expected: %v\n", expected)
+		t.Errorf("got:      %v\n", got)
+	}
+}
+
+func TestConsumeFields(t *testing.T) {
+	t.Parallel()
+
+	var b []byte = protowire.AppendTag(nil, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, 42)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 7))
+
+	var varint, nested uint64
+	e := ConsumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if 2 == num {
+			return ConsumeMessage(typ, b, func(msg []byte) error {
+				return ConsumeFields(msg, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+					v, n := protowire.ConsumeVarint(b)
+					nested = v
+					return n, nil
+				})
+			})
+		}
+		v, n := protowire.ConsumeVarint(b)
+		varint = v
+		return n, nil
+	})
+	if nil != e {
+		t.Fatalf("Unable to consume: %v", e)
+	}
+	checker(t, varint, 42)
+	checker(t, nested, 7)
+
+	e = ConsumeFields(b[:len(b)-1], func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+	if nil == e {
+		t.Errorf("Must fail(truncated)")
+	}
+
+	_, e = ConsumeMessage(protowire.VarintType, b, func(_ []byte) error { return nil })
+	if nil == e {
+		t.Errorf("Must fail(not a message)")
+	}
+}
@@ -0,0 +1,173 @@
+// Package tskey provides key encodings whose byte order matches the logical order.
+//
+// Keys of a data_<ymd>_<id> partition are listed in byte order,
+// so time or sequence based keys must be encoded by this package(or similar)
+// to get samples in chronological order.
+package tskey
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+)
+
+const (
+	escape     byte = 0x00
+	escaped    byte = 0xff
+	terminator byte = 0x01
+)
+
+func Uint64(u uint64) []byte { return binary.BigEndian.AppendUint64(nil, u) }
+
+// Int64 encodes an integer as big endian with the sign bit flipped(negative values first).
+func Int64(i int64) []byte { return sp.OrderedInt64(i) }
+
+// Time encodes a time as Int64(unix nanos).
+func Time(t time.Time) []byte { return sp.OrderedTime(t) }
+
+// Seq encodes a sequence number.
+func Seq(seq uint64) []byte { return Uint64(seq) }
+
+func Uint64Decode(b []byte) (uint64, error) {
+	if 8 != len(b) {
+		return 0, fmt.Errorf("Invalid key(len=%v)", len(b))
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func Int64Decode(b []byte) (int64, error)    { return sp.Int64Codec.Decode(b) }
+func TimeDecode(b []byte) (time.Time, error) { return sp.TimeCodec.Decode(b) }
+
+func SeqDecode(b []byte) (uint64, error) { return Uint64Decode(b) }
+
+// Tuple is a composite key. Tuples are ordered element by element.
+//
+// Appending to a tuple never modifies it: tuples built from a shared prefix are independent.
+type Tuple []byte
+
+func TupleNew() Tuple { return Tuple{} }
+
+// capped limits the capacity so that append always copies.
+func (t Tuple) capped() Tuple { return t[:len(t):len(t)] }
+
+func (t Tuple) Uint64(u uint64) Tuple   { return append(t.capped(), Uint64(u)...) }
+func (t Tuple) Int64(i int64) Tuple     { return append(t.capped(), Int64(i)...) }
+func (t Tuple) Time(tm time.Time) Tuple { return append(t.capped(), Time(tm)...) }
+func (t Tuple) Seq(seq uint64) Tuple    { return append(t.capped(), Seq(seq)...) }
+func (t Tuple) String(s string) Tuple   { return t.Bytes([]byte(s)) }
+func (t Tuple) Range() Range            { return PrefixRange(t) }
+func (t Tuple) AsKey() []byte           { return t }
+func (t Tuple) Reader() *TupleReader    { return &TupleReader{rest: t} }
+
+// Bytes appends variable length bytes.
+// 0x00 is escaped as 0x00 0xff and the bytes end with 0x00 0x01.
+func (t Tuple) Bytes(b []byte) Tuple {
+	t = t.capped()
+	for _, c := range b {
+		t = append(t, c)
+		if escape == c {
+			t = append(t, escaped)
+		}
+	}
+	return append(t, escape, terminator)
+}
+
+type TupleReader struct {
+	rest []byte
+}
+
+func TupleReaderNew(key []byte) *TupleReader { return Tuple(key).Reader() }
+
+func (r *TupleReader) Rest() []byte { return r.rest }
+
+func (r *TupleReader) Uint64() (uint64, error) {
+	if len(r.rest) < 8 {
+		return 0, fmt.Errorf("Invalid tuple(rest=%v)", len(r.rest))
+	}
+	u, _ := Uint64Decode(r.rest[:8])
+	r.rest = r.rest[8:]
+	return u, nil
+}
+
+func (r *TupleReader) Int64() (int64, error) {
+	u, e := r.Uint64()
+	if nil != e {
+		return 0, e
+	}
+	return Int64Decode(Uint64(u))
+}
+
+func (r *TupleReader) Time() (time.Time, error) {
+	i, e := r.Int64()
+	return time.Unix(0, i).UTC(), e
+}
+
+func (r *TupleReader) Seq() (uint64, error) { return r.Uint64() }
+
+func (r *TupleReader) Bytes() ([]byte, error) {
+	var b []byte
+	for i := 0; i < len(r.rest); i++ {
+		var c byte = r.rest[i]
+		if escape != c {
+			b = append(b, c)
+			continue
+		}
+		if len(r.rest) <= i+1 {
+			break
+		}
+		switch r.rest[i+1] {
+		case escaped:
+			b = append(b, escape)
+			i += 1
+		case terminator:
+			r.rest = r.rest[i+2:]
+			return b, nil
+		default:
+			return nil, fmt.Errorf("Invalid escape: %v", r.rest[i+1])
+		}
+	}
+	return nil, fmt.Errorf("Unterminated bytes")
+}
+
+func (r *TupleReader) String() (string, error) {
+	b, e := r.Bytes()
+	return string(b), e
+}
+
+// Range is a key range [Lo, Hi). nil means unbounded.
+type Range struct {
+	Lo []byte
+	Hi []byte
+}
+
+func TimeRange(start, end time.Time) Range { return Range{Lo: Time(start), Hi: Time(end)} }
+func SeqRange(lo, hi uint64) Range         { return Range{Lo: Seq(lo), Hi: Seq(hi)} }
+
+// PrefixRange creates a range which contains all keys starting with the prefix.
+func PrefixRange(prefix []byte) Range {
+	var hi []byte = bytes.Clone(prefix)
+	for i := len(hi) - 1; 0 <= i; i-- {
+		if 0xff != hi[i] {
+			hi[i] += 1
+			return Range{Lo: bytes.Clone(prefix), Hi: hi[:i+1]}
+		}
+	}
+	return Range{Lo: bytes.Clone(prefix), Hi: nil}
+}
+
+func (r Range) Contains(key []byte) bool {
+	var geLo bool = nil == r.Lo || 0 <= bytes.Compare(key, r.Lo)
+	var ltHi bool = nil == r.Hi || bytes.Compare(key, r.Hi) < 0
+	return geLo && ltHi
+}
+
+// Scan gets samples in the range from the partition which contains the date.
+func (r Range) Scan(ctx context.Context, read sp.PartitionRangeRead, id string, date time.Time) (s2k.Iter[sp.TsSample], error) {
+	return read(ctx, id, date, r.Lo, r.Hi)
+}
@@ -0,0 +1,183 @@
+package tskey
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+)
+
+func checker[T comparable](t *testing.T, got T, expected T) {
+	if got != expected {
+		t.Errorf("Unexpected value got.\n")
+		t.Errorf("expected: %v\n", expected)
+		t.Errorf("got:      %v\n", got)
+	}
+}
+
+func sortedBy[T any](t *testing.T, ordered []T, enc func(T) []byte) {
+	for i := 1; i < len(ordered); i++ {
+		a := enc(ordered[i-1])
+		b := enc(ordered[i])
+		if 0 <= bytes.Compare(a, b) {
+			t.Errorf("Unexpected order: %v >= %v", ordered[i-1], ordered[i])
+		}
+	}
+}
+
+func TestTskey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Time", func(t *testing.T) {
+		t.Parallel()
+
+		var epoch time.Time = time.Unix(0, 0).UTC()
+		sortedBy(t, []time.Time{
+			epoch.Add(-time.Hour),
+			epoch.Add(-1),
+			epoch,
+			epoch.Add(1),
+			time.Date(2022, time.August, 26, 0, 0, 0, 0, time.UTC),
+		}, Time)
+
+		var dt time.Time = time.Date(1969, time.July, 20, 20, 17, 40, 0, time.UTC)
+		got, e := TimeDecode(Time(dt))
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(t, got, dt)
+
+		_, e = TimeDecode([]byte{0x00})
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+	})
+
+	t.Run("Seq", func(t *testing.T) {
+		t.Parallel()
+
+		sortedBy(t, []uint64{0, 1, 255, 256, 1 << 40}, Seq)
+		got, e := SeqDecode(Seq(42))
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(t, got, 42)
+	})
+
+	t.Run("Tuple", func(t *testing.T) {
+		t.Parallel()
+
+		type pair struct {
+			s string
+			i int64
+		}
+		enc := func(p pair) []byte { return TupleNew().String(p.s).Int64(p.i) }
+		sortedBy(t, []pair{
+			{"", 0},
+			{"a", -1},
+			{"a", 0},
+			{"a\x00", -5},
+			{"a\x00\x00", -5},
+			{"a\x01", -5},
+			{"ab", -5},
+			{"b", -5},
+		}, enc)
+
+		rdr := TupleReaderNew(enc(pair{"a\x00b", -3}))
+		s, e := rdr.String()
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(t, s, "a\x00b")
+		i, e := rdr.Int64()
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(t, i, -3)
+		checker(t, len(rdr.Rest()), 0)
+
+		_, e = TupleReaderNew([]byte("unterminated")).Bytes()
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+	})
+
+	t.Run("SharedPrefix", func(t *testing.T) {
+		t.Parallel()
+
+		prefix := make(Tuple, 0, 64).String("cpu")
+		a := prefix.String("user").Int64(1)
+		b := prefix.String("system").Int64(2)
+		c := prefix.Seq(3)
+
+		checker(t, string(a), string(TupleNew().String("cpu").String("user").Int64(1)))
+		checker(t, string(b), string(TupleNew().String("cpu").String("system").Int64(2)))
+		checker(t, string(c), string(TupleNew().String("cpu").Seq(3)))
+		checker(t, string(prefix), string(TupleNew().String("cpu")))
+	})
+
+	t.Run("PrefixRange", func(t *testing.T) {
+		t.Parallel()
+
+		var r Range = TupleNew().String("temp").Range()
+		checker(t, r.Contains(TupleNew().String("temp").Seq(0)), true)
+		checker(t, r.Contains(TupleNew().String("temp").Seq(1<<63)), true)
+		checker(t, r.Contains(TupleNew().String("tempo").Seq(0)), false)
+		checker(t, r.Contains(TupleNew().String("tem").Seq(0)), false)
+
+		r = PrefixRange([]byte{0x01, 0xff})
+		checker(t, bytes.Equal(r.Hi, []byte{0x02}), true)
+
+		r = PrefixRange([]byte{0xff})
+		checker(t, nil == r.Hi, true)
+	})
+
+	t.Run("Scan", func(t *testing.T) {
+		t.Parallel()
+
+		var day time.Time = time.Date(2022, time.August, 26, 0, 0, 0, 0, time.UTC)
+		data := make(map[string][]byte)
+		for i := 0; i < 24; i++ {
+			data[string(Time(day.Add(time.Duration(i)*time.Hour)))] = []byte(fmt.Sprint(i))
+		}
+
+		var lst s2k.Lst = func(_ context.Context, _ string, cb func(key []byte) error) error {
+			var keys []string
+			for k := range data {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				e := cb([]byte(k))
+				if nil != e {
+					return e
+				}
+			}
+			return nil
+		}
+		var get s2k.Get = func(_ context.Context, _ string, key []byte) ([]byte, error) {
+			return data[string(key)], nil
+		}
+		var read sp.PartitionRangeRead = sp.NewPartitionRangeReader(lst, get)(sp.YmdConverter)
+
+		samples, e := TimeRange(day.Add(3*time.Hour), day.Add(6*time.Hour)).Scan(
+			context.Background(),
+			read,
+			"cafef00d",
+			day,
+		)
+		if nil != e {
+			t.Fatalf("Unable to scan: %v", e)
+		}
+		var got []sp.TsSample = samples.ToArray()
+		checker(t, len(got), 3)
+		checker(t, string(got[0].AsVal()), "3")
+		checker(t, string(got[2].AsVal()), "5")
+	})
+}
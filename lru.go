@@ -0,0 +1,80 @@
+package stdb
+
+import (
+	"container/list"
+	"time"
+)
+
+type lruEntry struct {
+	key   string
+	added time.Time
+}
+
+// lru orders keys by use(used by IndexCache and BucketCache). Callers must lock.
+type lru struct {
+	size  int // unlimited if 0
+	elems map[string]*list.Element
+	order *list.List // front: most recently used
+}
+
+func lruNew(size int) *lru {
+	return &lru{
+		size:  size,
+		elems: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// peek gets the time the key was added without updating the order.
+func (l *lru) peek(key string) (added time.Time, found bool) {
+	elem, found := l.elems[key]
+	if !found {
+		return added, false
+	}
+	return elem.Value.(lruEntry).added, true
+}
+
+// touch marks the key as most recently used.
+func (l *lru) touch(key string) {
+	if elem, found := l.elems[key]; found {
+		l.order.MoveToFront(elem)
+	}
+}
+
+// add adds(or refreshes) the key and gets the number of evicted keys.
+func (l *lru) add(key string, added time.Time) (evicted int) {
+	var entry lruEntry = lruEntry{key: key, added: added}
+	if elem, found := l.elems[key]; found {
+		elem.Value = entry
+		l.order.MoveToFront(elem)
+		return 0
+	}
+	l.elems[key] = l.order.PushFront(entry)
+	for 0 < l.size && l.size < l.order.Len() {
+		l.remove(l.order.Back().Value.(lruEntry).key)
+		evicted += 1
+	}
+	return
+}
+
+func (l *lru) remove(key string) {
+	if elem, found := l.elems[key]; found {
+		l.order.Remove(elem)
+		delete(l.elems, key)
+	}
+}
+
+func (l *lru) removeIf(filter func(key string) bool) {
+	for key := range l.elems {
+		if filter(key) {
+			l.remove(key)
+		}
+	}
+}
+
+func (l *lru) purge() {
+	l.elems = make(map[string]*list.Element)
+	l.order.Init()
+}
+
+func (l *lru) len() int { return l.order.Len() }
@@ -0,0 +1,39 @@
+package stdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLru(t *testing.T) {
+	t.Parallel()
+
+	var l *lru = lruNew(2)
+	var dt time.Time = time.Date(2022, time.August, 26, 0, 0, 0, 0, time.UTC)
+
+	checker(0, l.add("a", dt), t)
+	checker(0, l.add("b", dt), t)
+	l.touch("a") // b is the least recently used
+	checker(1, l.add("c", dt), t)
+	checker(2, l.len(), t)
+
+	_, found := l.peek("b")
+	checker(false, found, t)
+
+	checker(0, l.add("a", dt.Add(time.Second)), t)
+	added, found := l.peek("a")
+	checker(true, found, t)
+	checker(dt.Add(time.Second), added, t)
+
+	l.removeIf(func(key string) bool { return "c" == key })
+	checker(1, l.len(), t)
+
+	l.purge()
+	checker(0, l.len(), t)
+
+	var unlimited *lru = lruNew(0)
+	for _, key := range []string{"a", "b", "c"} {
+		checker(0, unlimited.add(key, dt), t)
+	}
+	checker(3, unlimited.len(), t)
+}
@@ -0,0 +1,176 @@
+package stdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+// Partitioner maps a time to a partition label and the label back to [start, end).
+// Label can be used as a Date2Str.
+type Partitioner interface {
+	Label(t time.Time) string
+	Interval(label string) (start, end time.Time, e error)
+}
+
+type calendarPartitioner struct {
+	format   Date2Str
+	interval Str2Interval
+}
+
+func (c calendarPartitioner) Label(t time.Time) string { return c.format(t) }
+
+func (c calendarPartitioner) Interval(label string) (start, end time.Time, e error) {
+	return c.interval(label)
+}
+
+// LayoutPartitionerNew creates a partitioner which labels times in the location using the layout.
+func LayoutPartitionerNew(layout string, loc *time.Location) (Partitioner, error) {
+	parser, e := NewDateParserInLocation(layout, loc)
+	if nil != e {
+		return nil, e
+	}
+	return calendarPartitioner{
+		format:   NewDateConverterInLocation(layout, loc),
+		interval: parser,
+	}, nil
+}
+
+func layoutPartitionerNew(layout string, loc *time.Location) calendarPartitioner {
+	return calendarPartitioner{
+		format:   NewDateConverterInLocation(layout, loc),
+		interval: newDateParserMust(layout, loc),
+	}
+}
+
+func isoWeekStart(year, week int, loc *time.Location) time.Time {
+	var jan4 time.Time = time.Date(year, time.January, 4, 0, 0, 0, 0, loc)
+	var sinceMonday int = (int(jan4.Weekday()) + 6) % 7
+	return jan4.AddDate(0, 0, 7*(week-1)-sinceMonday)
+}
+
+func isoWeekConverterNew(loc *time.Location) Date2Str {
+	return func(t time.Time) string {
+		year, week := t.In(loc).ISOWeek()
+		return fmt.Sprintf("%04dw%02d", year, week)
+	}
+}
+
+func weekPartitionerNew(loc *time.Location) calendarPartitioner {
+	var format Date2Str = isoWeekConverterNew(loc)
+	return calendarPartitioner{
+		format: format,
+		interval: func(label string) (start, end time.Time, e error) {
+			var year, week int
+			_, e = fmt.Sscanf(label, "%04dw%02d", &year, &week)
+			if nil != e {
+				return start, end, fmt.Errorf("Invalid label(%s): %v", label, e)
+			}
+			start = isoWeekStart(year, week, loc)
+			if label != format(start) {
+				return start, end, fmt.Errorf("Invalid label: %s", label)
+			}
+			return start, start.AddDate(0, 0, 7), nil
+		},
+	}
+}
+
+func HourPartitionerIn(loc *time.Location) Partitioner {
+	return layoutPartitionerNew("2006010215", loc)
+}
+func DayPartitionerIn(loc *time.Location) Partitioner   { return layoutPartitionerNew(patYmd, loc) }
+func WeekPartitionerIn(loc *time.Location) Partitioner  { return weekPartitionerNew(loc) }
+func MonthPartitionerIn(loc *time.Location) Partitioner { return layoutPartitionerNew("200601", loc) }
+func YearPartitionerIn(loc *time.Location) Partitioner  { return layoutPartitionerNew("2006", loc) }
+
+// times are normalized to UTC
+var (
+	HourPartitioner  Partitioner = HourPartitionerIn(time.UTC)
+	DayPartitioner   Partitioner = DayPartitionerIn(time.UTC)
+	WeekPartitioner  Partitioner = WeekPartitionerIn(time.UTC) // ISO week: 2022w34
+	MonthPartitioner Partitioner = MonthPartitionerIn(time.UTC)
+	YearPartitioner  Partitioner = YearPartitionerIn(time.UTC)
+)
+
+// RangeRead gets all samples in the partitions which overlap [start, end).
+type RangeRead func(ctx context.Context, id string, start, end time.Time) (s2k.Iter[TsSample], error)
+
+// RangeScan passes the samples of the partitions which overlap [start, end) to f one partition at a time.
+// Partitions are scanned in order of the start. The scan stops if f returns false.
+type RangeScan func(ctx context.Context, id string, start, end time.Time, f func(partition []TsSample) bool) error
+
+// AsRangeRead creates a reader which scans all partitions.
+func (s RangeScan) AsRangeRead() RangeRead {
+	return func(ctx context.Context, id string, start, end time.Time) (s2k.Iter[TsSample], error) {
+		var samples []TsSample
+		e := s(ctx, id, start, end, func(partition []TsSample) bool {
+			samples = append(samples, partition...)
+			return true
+		})
+		return s2k.IterFromArray(samples), e
+	}
+}
+
+// AsRangeScan creates a scanner which passes all samples at once(for readers without partitions).
+func (r RangeRead) AsRangeScan() RangeScan {
+	return func(ctx context.Context, id string, start, end time.Time, f func(partition []TsSample) bool) error {
+		many, e := r(ctx, id, start, end)
+		if nil != e {
+			return e
+		}
+		var samples []TsSample = many.ToArray()
+		if 0 < len(samples) {
+			_ = f(samples)
+		}
+		return nil
+	}
+}
+
+// NewRangeScanner creates a scanner which resolves partitions using the partitioner.
+// Partitions missing in dates_<id> are skipped.
+// The date of the samples will be the start of the partition.
+func NewRangeScanner(lst s2k.Lst, get s2k.Get) func(p Partitioner) RangeScan {
+	return func(p Partitioner) RangeScan {
+		return func(ctx context.Context, id string, start, end time.Time, f func(partition []TsSample) bool) error {
+			labels, e := CatalogNew(lst).DatesOf(ctx, id)
+			if nil != e {
+				return e
+			}
+			found := make(map[string]struct{}, len(labels))
+			for _, label := range labels {
+				found[label] = struct{}{}
+			}
+
+			for t := start.UTC(); t.Before(end); {
+				var label string = p.Label(t)
+				pstart, pend, e := p.Interval(label)
+				if nil != e {
+					return e
+				}
+				if !pend.After(t) {
+					return fmt.Errorf("Invalid partition(%s): %v", label, pend)
+				}
+				if _, ok := found[label]; ok {
+					s, e := readPartition(ctx, lst, get, id, pstart, label)
+					if nil != e {
+						return e
+					}
+					if !f(s) {
+						return nil
+					}
+				}
+				t = pend
+			}
+			return nil
+		}
+	}
+}
+
+// NewRangeReader creates a reader which resolves partitions using the partitioner(see NewRangeScanner).
+func NewRangeReader(lst s2k.Lst, get s2k.Get) func(p Partitioner) RangeRead {
+	return func(p Partitioner) RangeRead {
+		return NewRangeScanner(lst, get)(p).AsRangeRead()
+	}
+}
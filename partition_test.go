@@ -0,0 +1,212 @@
+package stdb
+
+import (
+	"context"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+func TestPartitioner(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 0, time.UTC)
+
+	type testCase struct {
+		name  string
+		p     Partitioner
+		label string
+		start time.Time
+		end   time.Time
+	}
+
+	cases := []testCase{
+		{"hour", HourPartitioner, "2022082613",
+			time.Date(2022, time.August, 26, 13, 0, 0, 0, time.UTC),
+			time.Date(2022, time.August, 26, 14, 0, 0, 0, time.UTC)},
+		{"day", DayPartitioner, "20220826",
+			time.Date(2022, time.August, 26, 0, 0, 0, 0, time.UTC),
+			time.Date(2022, time.August, 27, 0, 0, 0, 0, time.UTC)},
+		{"week", WeekPartitioner, "2022w34",
+			time.Date(2022, time.August, 22, 0, 0, 0, 0, time.UTC),
+			time.Date(2022, time.August, 29, 0, 0, 0, 0, time.UTC)},
+		{"month", MonthPartitioner, "202208",
+			time.Date(2022, time.August, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2022, time.September, 1, 0, 0, 0, 0, time.UTC)},
+		{"year", YearPartitioner, "2022",
+			time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			checker(c.label, c.p.Label(dt), t)
+
+			start, end, e := c.p.Interval(c.label)
+			if nil != e {
+				t.Fatalf("Unable to get interval: %v", e)
+			}
+			checker(c.start, start, t)
+			checker(c.end, end, t)
+
+			_, _, e = c.p.Interval("x" + c.label)
+			if nil == e {
+				t.Errorf("Must fail")
+			}
+		})
+	}
+
+	t.Run("iso week boundary", func(t *testing.T) {
+		t.Parallel()
+
+		var sunday time.Time = time.Date(2021, time.January, 3, 12, 0, 0, 0, time.UTC)
+		checker("2020w53", WeekPartitioner.Label(sunday), t)
+
+		start, _, e := WeekPartitioner.Interval("2020w53")
+		if nil != e {
+			t.Fatalf("Unable to get interval: %v", e)
+		}
+		checker(time.Date(2020, time.December, 28, 0, 0, 0, 0, time.UTC), start, t)
+
+		_, _, e = WeekPartitioner.Interval("2021w53")
+		if nil == e {
+			t.Errorf("2021 has no week 53")
+		}
+	})
+
+	t.Run("NewRangeReader", func(t *testing.T) {
+		t.Parallel()
+
+		kv := memKvNew()
+		var bset BatchSet = NewBatchSetter(kv.AddBucket, kv.SetBatch, 16)(HourPartitioner.Label)
+		e := bset(context.Background(), s2k.IterFromArray([]TsSample{
+			TsSampleNew("i3776", dt.Add(-2*time.Hour), []byte("a"), []byte("0")),
+			TsSampleNew("i3776", dt, []byte("b"), []byte("1")),
+			TsSampleNew("i3776", dt.Add(time.Hour), []byte("c"), []byte("2")),
+		}))
+		if nil != e {
+			t.Fatalf("Unable to set: %v", e)
+		}
+
+		var read RangeRead = NewRangeReader(kv.Lst, kv.Get)(HourPartitioner)
+		i, e := read(context.Background(), "i3776", dt.Add(-time.Hour), dt.Add(time.Hour))
+		if nil != e {
+			t.Fatalf("Unable to read: %v", e)
+		}
+		var samples []TsSample = i.ToArray()
+		checker(2, len(samples), t) // 12:00(missing), 13:00, 14:00
+		checker("1", string(samples[0].AsVal()), t)
+		checker("2", string(samples[1].AsVal()), t)
+		checker(time.Date(2022, time.August, 26, 13, 0, 0, 0, time.UTC), samples[0].date, t)
+
+		var partitions int
+		var scan RangeScan = NewRangeScanner(kv.Lst, kv.Get)(HourPartitioner)
+		e = scan(context.Background(), "i3776", dt.Add(-2*time.Hour), dt.Add(2*time.Hour), func(partition []TsSample) bool {
+			partitions += 1
+			checker(1, len(partition), t)
+			return 2 > partitions
+		})
+		if nil != e {
+			t.Fatalf("Unable to scan: %v", e)
+		}
+		checker(2, partitions, t) // stopped after 13:00
+	})
+}
+
+func TestPartitionerInLocation(t *testing.T) {
+	t.Parallel()
+
+	ny, e := time.LoadLocation("America/New_York")
+	if nil != e {
+		t.Fatalf("Unable to load location: %v", e)
+	}
+
+	t.Run("same instant same label", func(t *testing.T) {
+		t.Parallel()
+
+		var utc time.Time = time.Date(2022, time.August, 26, 23, 30, 0, 0, time.UTC)
+		var tokyo time.Time = utc.In(time.FixedZone("JST", 9*60*60))
+
+		checker("20220826", DayPartitioner.Label(utc), t)
+		checker("20220826", DayPartitioner.Label(tokyo), t)
+
+		var p Partitioner = DayPartitionerIn(ny)
+		checker("20220826", p.Label(utc), t)
+		checker("20220826", p.Label(tokyo), t)
+		checker("20220827", p.Label(utc.Add(5*time.Hour)), t)
+	})
+
+	t.Run("dst start", func(t *testing.T) {
+		t.Parallel()
+
+		var p Partitioner = DayPartitionerIn(ny)
+		start, end, e := p.Interval("20220313")
+		if nil != e {
+			t.Fatalf("Unable to get interval: %v", e)
+		}
+		checker(time.Date(2022, time.March, 13, 5, 0, 0, 0, time.UTC), start.UTC(), t)
+		checker(23*time.Hour, end.Sub(start), t)
+
+		_, _, e = HourPartitionerIn(ny).Interval("2022031302")
+		if nil == e {
+			t.Errorf("02:00 does not exist")
+		}
+	})
+
+	t.Run("dst end", func(t *testing.T) {
+		t.Parallel()
+
+		var p Partitioner = DayPartitionerIn(ny)
+		start, end, e := p.Interval("20221106")
+		if nil != e {
+			t.Fatalf("Unable to get interval: %v", e)
+		}
+		checker(time.Date(2022, time.November, 6, 4, 0, 0, 0, time.UTC), start.UTC(), t)
+		checker(25*time.Hour, end.Sub(start), t)
+
+		var h Partitioner = HourPartitionerIn(ny)
+		start, end, e = h.Interval("2022110601")
+		if nil != e {
+			t.Fatalf("Unable to get interval: %v", e)
+		}
+		checker(time.Date(2022, time.November, 6, 5, 0, 0, 0, time.UTC), start.UTC(), t)
+		checker(2*time.Hour, end.Sub(start), t) // 01:00 EDT - 01:59 EST
+		checker("2022110601", h.Label(time.Date(2022, time.November, 6, 6, 30, 0, 0, time.UTC)), t)
+	})
+
+	t.Run("week", func(t *testing.T) {
+		t.Parallel()
+
+		var p Partitioner = WeekPartitionerIn(ny)
+		// monday 02:00 UTC is still sunday in new york
+		var monday time.Time = time.Date(2022, time.August, 22, 2, 0, 0, 0, time.UTC)
+		checker("2022w33", p.Label(monday), t)
+		checker("2022w34", WeekPartitioner.Label(monday), t)
+
+		start, _, e := p.Interval("2022w34")
+		if nil != e {
+			t.Fatalf("Unable to get interval: %v", e)
+		}
+		checker(time.Date(2022, time.August, 22, 4, 0, 0, 0, time.UTC), start.UTC(), t)
+	})
+
+	t.Run("LayoutPartitionerNew", func(t *testing.T) {
+		t.Parallel()
+
+		_, e := LayoutPartitionerNew("2006-01-02", ny)
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+
+		p, e := LayoutPartitionerNew("20060102_15", ny)
+		if nil != e {
+			t.Fatalf("Unable to create partitioner: %v", e)
+		}
+		checker("20220826_09", p.Label(time.Date(2022, time.August, 26, 13, 0, 0, 0, time.UTC)), t)
+	})
+}
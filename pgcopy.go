@@ -0,0 +1,100 @@
+package stdb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+const pgStaging = "stdb_staging"
+
+// same rule as the postgres query generator of go-sql2keyval
+var pgBucketChecker *regexp.Regexp = regexp.MustCompile(`^[a-z][0-9a-z_]{0,58}$`)
+
+func pgMergeQuery(bucket string) string {
+	return `INSERT INTO ` + bucket + `(key, val)
+		SELECT DISTINCT ON(key) key, val FROM ` + pgStaging + `
+		WHERE bucket=$1
+		ORDER BY key
+		ON CONFLICT ON CONSTRAINT ` + bucket + `_pkc
+		DO NOTHING`
+}
+
+// samples2rows converts samples to staging rows and buckets.
+// Index rows(devices, dates, ...) are deduplicated.
+func samples2rows(many s2k.Iter[TsSample], d2s Date2Str) (rows [][]interface{}, buckets []string) {
+	var dedup *batchDedup = batchDedupNew(nil)
+	var batches []s2k.Batch
+	for o := many(); o.HasValue(); o = many() {
+		batches = dedup.append(batches, o.Value(), d2s)
+	}
+
+	found := make(map[string]struct{})
+	for _, b := range batches {
+		var bucket string = b.Bucket()
+		if _, ok := found[bucket]; !ok {
+			found[bucket] = struct{}{}
+			buckets = append(buckets, bucket)
+		}
+		rows = append(rows, []interface{}{bucket, b.Pair().Key, b.Pair().Val})
+	}
+	return
+}
+
+// NewPgBulkLoader creates a batch setter for initial imports.
+// Samples are copied to a staging table(COPY) and merged into the bucket tables.
+// Existing keys are kept(not updated) and the winner of duplicated keys in a batch is unspecified.
+func NewPgBulkLoader(pool *pgxpool.Pool, fastAdder s2k.AddBucket) func(dateConverter Date2Str) BatchSet {
+	return func(dateConverter Date2Str) BatchSet {
+		return func(ctx context.Context, many s2k.Iter[TsSample]) error {
+			rows, buckets := samples2rows(many, dateConverter)
+			if 0 == len(rows) {
+				return nil
+			}
+
+			for _, bucket := range buckets {
+				if !pgBucketChecker.MatchString(bucket) {
+					return fmt.Errorf("Invalid bucket name: %s", bucket)
+				}
+				e := fastAdder(ctx, bucket)
+				if nil != e {
+					return e
+				}
+			}
+
+			return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+				_, e := tx.Exec(ctx, `CREATE TEMP TABLE `+pgStaging+`(
+					bucket TEXT NOT NULL,
+					key BYTEA NOT NULL,
+					val BYTEA NOT NULL
+				) ON COMMIT DROP`)
+				if nil != e {
+					return e
+				}
+
+				_, e = tx.CopyFrom(
+					ctx,
+					pgx.Identifier{pgStaging},
+					[]string{"bucket", "key", "val"},
+					pgx.CopyFromRows(rows),
+				)
+				if nil != e {
+					return e
+				}
+
+				for _, bucket := range buckets {
+					_, e = tx.Exec(ctx, pgMergeQuery(bucket), bucket)
+					if nil != e {
+						return e
+					}
+				}
+				return nil
+			})
+		}
+	}
+}
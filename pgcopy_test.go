@@ -0,0 +1,71 @@
+package stdb
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+	spx "github.com/takanoriyanagitani/go-sql2keyval/pkg/postgres/pgx"
+)
+
+func TestPgBulkLoader(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 0, 0, 0, 0, time.UTC)
+
+	t.Run("samples2rows", func(t *testing.T) {
+		t.Parallel()
+
+		rows, buckets := samples2rows(s2k.IterFromArray([]TsSample{
+			TsSampleNew("i3776", dt, []byte("a"), []byte("0")),
+			TsSampleNew("i3776", dt, []byte("b"), []byte("1")),
+			TsSampleNew("i634", dt, []byte("c"), []byte("2")),
+		}), YmdConverter)
+
+		// devices: 2, dates: 1, dates_<id>: 2, devices_<ymd>: 2, data: 3
+		checker(10, len(rows), t)
+
+		// devices, dates, dates_i3776, devices_20220826, data_20220826_i3776, dates_i634, data_20220826_i634
+		checker(7, len(buckets), t)
+		checker("data_20220826_i3776", buckets[4], t)
+	})
+
+	t.Run("pgx test", func(t *testing.T) {
+		t.Parallel()
+
+		pgx_dbname := os.Getenv("ITEST_SPACETIMEDB_PGX_DBNAME")
+		if len(pgx_dbname) < 1 {
+			t.Skip("skipping pgx test...")
+		}
+
+		pool, e := pgxpool.Connect(context.Background(), "dbname="+pgx_dbname)
+		if nil != e {
+			t.Fatalf("Unable to connect: %v", e)
+		}
+		t.Cleanup(func() { pool.Close() })
+
+		var d2s Date2Str = func(_ time.Time) string { return "1990_01_01" }
+		var fastCreator s2k.AddBucket = FastBucketAdderNew(spx.PgxAddBucketNew(pool))
+		var load BatchSet = NewPgBulkLoader(pool, fastCreator)(d2s)
+
+		e = load(context.Background(), s2k.IterFromArray([]TsSample{
+			TsSampleNew("i42", dt, []byte("a"), []byte("0")),
+			TsSampleNew("i42", dt, []byte("a"), []byte("1")),
+			TsSampleNew("i42", dt, []byte("b"), []byte("2")),
+		}))
+		if nil != e {
+			t.Fatalf("Unable to load: %v", e)
+		}
+
+		var cnt int
+		e = pool.QueryRow(context.Background(), "SELECT COUNT(*) FROM data_1990_01_01_i42").Scan(&cnt)
+		if nil != e {
+			t.Fatalf("Unable to count: %v", e)
+		}
+		checker(2, cnt, t)
+	})
+}
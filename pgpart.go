@@ -0,0 +1,282 @@
+package stdb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+var pgTableChecker *regexp.Regexp = regexp.MustCompile(`^[a-z][0-9a-z_]{0,30}$`)
+
+// PgPartitioned stores all samples in a single table using postgres declarative partitioning.
+//
+//	<table>:                 partitioned by range on date(the start of the partition)
+//	<table>_<label>:         a partition(optionally partitioned by hash on id)
+//	<table>_<label>_h<rem>:  a hash partition
+//	<table>_index:           (id, date) pairs(replaces devices/dates buckets)
+type PgPartitioned struct {
+	pool    *pgxpool.Pool
+	table   string
+	part    Partitioner
+	modulus int
+	created *BucketCache // partitions
+	adder   s2k.AddBucket
+}
+
+type PgPartitionedOption func(p *PgPartitioned)
+
+// PgHashPartitions partitions each range partition by hash on id.
+func PgHashPartitions(modulus int) PgPartitionedOption {
+	return func(p *PgPartitioned) { p.modulus = modulus }
+}
+
+func PgPartitionedNew(pool *pgxpool.Pool, table string, part Partitioner, opts ...PgPartitionedOption) (*PgPartitioned, error) {
+	if !pgTableChecker.MatchString(table) {
+		return nil, fmt.Errorf("Invalid table name: %s", table)
+	}
+	p := &PgPartitioned{
+		pool:  pool,
+		table: table,
+		part:  part,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.created = BucketCacheNew()
+	p.adder = p.created.AsAdder(p.addPartition)
+	return p, nil
+}
+
+func pgParentDDL(table string) []string {
+	return []string{
+		`CREATE TABLE IF NOT EXISTS ` + table + `(
+		  id TEXT NOT NULL,
+		  date TIMESTAMPTZ NOT NULL,
+		  key BYTEA NOT NULL,
+		  val BYTEA NOT NULL,
+		  CONSTRAINT ` + table + `_pkc PRIMARY KEY(id, date, key)
+		) PARTITION BY RANGE(date)`,
+		`CREATE TABLE IF NOT EXISTS ` + table + `_index(
+		  id TEXT NOT NULL,
+		  date TIMESTAMPTZ NOT NULL,
+		  CONSTRAINT ` + table + `_index_pkc PRIMARY KEY(id, date)
+		)`,
+	}
+}
+
+func pgTimestamp(t time.Time) string { return "'" + t.UTC().Format(time.RFC3339Nano) + "'" }
+
+func pgPartitionDDL(table, label string, start, end time.Time, modulus int) []string {
+	var name string = table + "_" + label
+	var create string = `CREATE TABLE IF NOT EXISTS ` + name + ` PARTITION OF ` + table +
+		` FOR VALUES FROM (` + pgTimestamp(start) + `) TO (` + pgTimestamp(end) + `)`
+	if modulus < 2 {
+		return []string{create}
+	}
+
+	ddl := []string{create + ` PARTITION BY HASH(id)`}
+	for rem := 0; rem < modulus; rem++ {
+		ddl = append(ddl, `CREATE TABLE IF NOT EXISTS `+name+`_h`+strconv.Itoa(rem)+
+			` PARTITION OF `+name+
+			` FOR VALUES WITH (MODULUS `+strconv.Itoa(modulus)+`, REMAINDER `+strconv.Itoa(rem)+`)`)
+	}
+	return ddl
+}
+
+func pgUpsertQuery(table string) string {
+	return `INSERT INTO ` + table + ` AS alias_insert(id, date, key, val)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT ON CONSTRAINT ` + table + `_pkc
+		DO UPDATE SET val=EXCLUDED.val
+		WHERE alias_insert.val != EXCLUDED.val`
+}
+
+func pgIndexQuery(table string) string {
+	return `INSERT INTO ` + table + `_index(id, date)
+		VALUES ($1, $2)
+		ON CONFLICT ON CONSTRAINT ` + table + `_index_pkc
+		DO NOTHING`
+}
+
+func (p *PgPartitioned) exec(ctx context.Context, queries []string) error {
+	for _, q := range queries {
+		_, e := p.pool.Exec(ctx, q)
+		if nil != e {
+			return e
+		}
+	}
+	return nil
+}
+
+// Init creates the parent table and the index table.
+func (p *PgPartitioned) Init(ctx context.Context) error { return p.exec(ctx, pgParentDDL(p.table)) }
+
+func (p *PgPartitioned) addPartition(ctx context.Context, label string) error {
+	start, end, e := p.part.Interval(label)
+	if nil != e {
+		return e
+	}
+	return p.exec(ctx, pgPartitionDDL(p.table, label, start, end, p.modulus))
+}
+
+func (p *PgPartitioned) partitionStart(ctx context.Context, date time.Time) (time.Time, error) {
+	var label string = p.part.Label(date)
+	start, _, e := p.part.Interval(label)
+	if nil != e {
+		return start, e
+	}
+	return start, p.adder(ctx, label)
+}
+
+func (p *PgPartitioned) queue(ctx context.Context, b *pgx.Batch, indexed map[string]struct{}, s TsSample) error {
+	start, e := p.partitionStart(ctx, s.date)
+	if nil != e {
+		return e
+	}
+	var ikey string = s.id + "\x00" + start.String()
+	if _, ok := indexed[ikey]; !ok {
+		indexed[ikey] = struct{}{}
+		b.Queue(pgIndexQuery(p.table), s.id, start)
+	}
+	b.Queue(pgUpsertQuery(p.table), s.id, start, s.AsKey(), s.AsVal())
+	return nil
+}
+
+func (p *PgPartitioned) send(ctx context.Context, b *pgx.Batch) error {
+	return p.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		br := tx.SendBatch(ctx, b)
+		for i := 0; i < b.Len(); i++ {
+			_, e := br.Exec()
+			if nil != e {
+				_ = br.Close()
+				return e
+			}
+		}
+		return br.Close()
+	})
+}
+
+func (p *PgPartitioned) AsSet() Set {
+	return func(ctx context.Context, id string, date time.Time, key, val []byte) error {
+		var b pgx.Batch
+		e := p.queue(ctx, &b, make(map[string]struct{}), TsSampleNew(id, date, key, val))
+		if nil != e {
+			return e
+		}
+		return p.send(ctx, &b)
+	}
+}
+
+func (p *PgPartitioned) AsBatchSet() BatchSet {
+	return func(ctx context.Context, many s2k.Iter[TsSample]) error {
+		var b pgx.Batch
+		indexed := make(map[string]struct{})
+		for o := many(); o.HasValue(); o = many() {
+			e := p.queue(ctx, &b, indexed, o.Value())
+			if nil != e {
+				return e
+			}
+		}
+		if 0 == b.Len() {
+			return nil
+		}
+		return p.send(ctx, &b)
+	}
+}
+
+// AsRangeRead creates a reader which gets samples in the partitions which overlap [start, end).
+func (p *PgPartitioned) AsRangeRead() RangeRead {
+	return func(ctx context.Context, id string, start, end time.Time) (s2k.Iter[TsSample], error) {
+		lbi, _, e := p.part.Interval(p.part.Label(start))
+		if nil != e {
+			return nil, e
+		}
+		rows, e := p.pool.Query(
+			ctx,
+			`SELECT id, date, key, val FROM `+p.table+`
+			WHERE id=$1 AND $2<=date AND date<$3
+			ORDER BY date, key`,
+			id, lbi, end,
+		)
+		if nil != e {
+			return nil, e
+		}
+		defer rows.Close()
+
+		var samples []TsSample
+		for rows.Next() {
+			var s TsSample
+			e = rows.Scan(&s.id, &s.date, &s.pair.Key, &s.pair.Val)
+			if nil != e {
+				return nil, e
+			}
+			s.date = s.date.UTC()
+			samples = append(samples, s)
+		}
+		return s2k.IterFromArray(samples), rows.Err()
+	}
+}
+
+func (p *PgPartitioned) lstStrings(ctx context.Context, query string, args ...any) (s []string, e error) {
+	rows, e := p.pool.Query(ctx, query, args...)
+	if nil != e {
+		return nil, e
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v string
+		e = rows.Scan(&v)
+		if nil != e {
+			return nil, e
+		}
+		s = append(s, v)
+	}
+	return s, rows.Err()
+}
+
+func (p *PgPartitioned) Devices(ctx context.Context) ([]string, error) {
+	return p.lstStrings(ctx, `SELECT DISTINCT id FROM `+p.table+`_index ORDER BY id`)
+}
+
+// DatesOf lists the partition labels which have samples of the device.
+func (p *PgPartitioned) DatesOf(ctx context.Context, id string) (labels []string, e error) {
+	rows, e := p.pool.Query(ctx, `SELECT date FROM `+p.table+`_index WHERE id=$1 ORDER BY date`, id)
+	if nil != e {
+		return nil, e
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var date time.Time
+		e = rows.Scan(&date)
+		if nil != e {
+			return nil, e
+		}
+		labels = append(labels, p.part.Label(date))
+	}
+	return labels, rows.Err()
+}
+
+// DevicesOn lists the devices which have samples in the partition.
+func (p *PgPartitioned) DevicesOn(ctx context.Context, label string) ([]string, error) {
+	start, _, e := p.part.Interval(label)
+	if nil != e {
+		return nil, e
+	}
+	return p.lstStrings(ctx, `SELECT id FROM `+p.table+`_index WHERE date=$1 ORDER BY id`, start)
+}
+
+// Drop removes all partitions and the index. Must not be used concurrently with writes.
+func (p *PgPartitioned) Drop(ctx context.Context) error {
+	p.created.Purge()
+	return p.exec(ctx, []string{
+		`DROP TABLE IF EXISTS ` + p.table,
+		`DROP TABLE IF EXISTS ` + p.table + `_index`,
+	})
+}
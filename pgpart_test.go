@@ -0,0 +1,107 @@
+package stdb
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+func TestPgPartitioned(t *testing.T) {
+	t.Parallel()
+
+	t.Run("PgPartitionedNew", func(t *testing.T) {
+		t.Parallel()
+
+		_, e := PgPartitionedNew(nil, "samples; DROP TABLE x", DayPartitioner)
+		if nil == e {
+			t.Errorf("Must reject invalid table name")
+		}
+	})
+
+	t.Run("pgPartitionDDL", func(t *testing.T) {
+		t.Parallel()
+
+		start, end, _ := DayPartitioner.Interval("20220826")
+
+		ddl := pgPartitionDDL("samples", "20220826", start, end, 0)
+		checker(1, len(ddl), t)
+		checker(true, strings.Contains(
+			ddl[0],
+			"samples_20220826 PARTITION OF samples FOR VALUES FROM ('2022-08-26T00:00:00Z') TO ('2022-08-27T00:00:00Z')",
+		), t)
+
+		ddl = pgPartitionDDL("samples", "20220826", start, end, 4)
+		checker(5, len(ddl), t)
+		checker(true, strings.HasSuffix(ddl[0], "PARTITION BY HASH(id)"), t)
+		checker(true, strings.Contains(ddl[4], "samples_20220826_h3 PARTITION OF samples_20220826"), t)
+		checker(true, strings.Contains(ddl[4], "MODULUS 4, REMAINDER 3"), t)
+	})
+
+	t.Run("pgx test", func(t *testing.T) {
+		t.Parallel()
+
+		pgx_dbname := os.Getenv("ITEST_SPACETIMEDB_PGX_DBNAME")
+		if len(pgx_dbname) < 1 {
+			t.Skip("skipping pgx test...")
+		}
+
+		pool, e := pgxpool.Connect(context.Background(), "dbname="+pgx_dbname)
+		if nil != e {
+			t.Fatalf("Unable to connect: %v", e)
+		}
+		t.Cleanup(func() { pool.Close() })
+
+		p, e := PgPartitionedNew(pool, "itest_samples", HourPartitioner, PgHashPartitions(2))
+		if nil != e {
+			t.Fatalf("Unable to create backend: %v", e)
+		}
+		e = p.Drop(context.Background())
+		if nil != e {
+			t.Fatalf("Unable to drop: %v", e)
+		}
+		e = p.Init(context.Background())
+		if nil != e {
+			t.Fatalf("Unable to init: %v", e)
+		}
+
+		var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 0, time.UTC)
+		e = p.AsBatchSet()(context.Background(), s2k.IterFromArray([]TsSample{
+			TsSampleNew("i3776", dt, []byte("a"), []byte("0")),
+			TsSampleNew("i3776", dt.Add(time.Hour), []byte("b"), []byte("1")),
+			TsSampleNew("i634", dt, []byte("c"), []byte("2")),
+		}))
+		if nil != e {
+			t.Fatalf("Unable to set: %v", e)
+		}
+		e = p.AsSet()(context.Background(), "i3776", dt, []byte("a"), []byte("3"))
+		if nil != e {
+			t.Fatalf("Unable to set: %v", e)
+		}
+
+		i, e := p.AsRangeRead()(context.Background(), "i3776", dt, dt.Add(time.Minute))
+		if nil != e {
+			t.Fatalf("Unable to read: %v", e)
+		}
+		var samples []TsSample = i.ToArray()
+		checker(1, len(samples), t)
+		checker("3", string(samples[0].AsVal()), t)
+
+		labels, e := p.DatesOf(context.Background(), "i3776")
+		if nil != e {
+			t.Fatalf("Unable to list dates: %v", e)
+		}
+		checker(2, len(labels), t)
+
+		devices, e := p.DevicesOn(context.Background(), "2022082613")
+		if nil != e {
+			t.Fatalf("Unable to list devices: %v", e)
+		}
+		checker(2, len(devices), t)
+	})
+}
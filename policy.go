@@ -0,0 +1,219 @@
+package stdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+// PolicyBucket records the partitioner name used for each device(key: id, val: name).
+// Policy setters also record the name of each partition in dates_<id>(key: label, val: name)
+// to be able to read partitions created before the policy changes.
+const PolicyBucket = "partitioners"
+
+// PartitionPolicy gets the partitioner name for the device.
+type PartitionPolicy func(ctx context.Context, id string) (name string, e error)
+
+type Partitioners map[string]Partitioner
+
+var DefaultPartitioners Partitioners = Partitioners{
+	"hour":  HourPartitioner,
+	"day":   DayPartitioner,
+	"week":  WeekPartitioner,
+	"month": MonthPartitioner,
+	"year":  YearPartitioner,
+}
+
+func (p Partitioners) Get(name string) (Partitioner, error) {
+	found, ok := p[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown partitioner: %s", name)
+	}
+	return found, nil
+}
+
+func (p Partitioners) resolve(ctx context.Context, policy PartitionPolicy, id string) (name string, found Partitioner, e error) {
+	name, e = policy(ctx, id)
+	if nil != e {
+		return
+	}
+	found, e = p.Get(name)
+	return
+}
+
+func StaticPolicyNew(name string) PartitionPolicy {
+	return func(_ context.Context, _ string) (string, error) { return name, nil }
+}
+
+func MapPolicyNew(m map[string]string, fallback string) PartitionPolicy {
+	return func(_ context.Context, id string) (string, error) {
+		name, ok := m[id]
+		if !ok {
+			return fallback, nil
+		}
+		return name, nil
+	}
+}
+
+// BucketPolicyNew creates a policy which gets the name from the bucket(key: id, val: name).
+// The fallback will be used for missing devices.
+func BucketPolicyNew(get s2k.Get, bucket string, fallback string) PartitionPolicy {
+	return func(ctx context.Context, id string) (string, error) {
+		val, e := get(ctx, bucket, []byte(id))
+		if errors.Is(e, sql.ErrNoRows) {
+			return fallback, nil
+		}
+		if nil != e {
+			return "", e
+		}
+		if 0 == len(val) {
+			return fallback, nil
+		}
+		return string(val), nil
+	}
+}
+
+// IndexPolicyNew creates a policy which gets the name recorded by policy setters.
+func IndexPolicyNew(get s2k.Get, fallback string) PartitionPolicy {
+	return BucketPolicyNew(get, PolicyBucket, fallback)
+}
+
+// NewPolicySetter creates a setter which partitions samples using the partitioner chosen by the policy.
+// The chosen name will be recorded in the PolicyBucket.
+func NewPolicySetter(adder s2k.AddBucket, setter s2k.Set) func(policy PartitionPolicy, parts Partitioners, runner CommandRunner) Set {
+	return func(policy PartitionPolicy, parts Partitioners, cmdRunner CommandRunner) Set {
+		return func(ctx context.Context, id string, date time.Time, key, val []byte) error {
+			name, p, e := parts.resolve(ctx, policy, id)
+			if nil != e {
+				return e
+			}
+			e = cmdRunner.Run([]func() ([]byte, error){
+				cmdRunner.CreateBuilder(PolicyBucket, adder)(ctx),
+				cmdRunner.UpsertBuilder(PolicyBucket, setter)(ctx, []byte(id), []byte(name)),
+			})
+			if nil != e {
+				return e
+			}
+			e = NewSetter(adder, setter)(p.Label, cmdRunner)(ctx, id, date, key, val)
+			if nil != e {
+				return e
+			}
+			return cmdRunner.Run([]func() ([]byte, error){
+				cmdRunner.UpsertBuilder(newDatesName(id), setter)(ctx, []byte(p.Label(date)), []byte(name)),
+			})
+		}
+	}
+}
+
+// NewPolicyBatchSetter creates a batch setter which partitions samples using the policy.
+// The policy is resolved once per device in a batch.
+func NewPolicyBatchSetter(fastAdder s2k.AddBucket, setter s2k.SetBatch) func(policy PartitionPolicy, parts Partitioners) BatchSet {
+	return func(policy PartitionPolicy, parts Partitioners) BatchSet {
+		return func(ctx context.Context, many s2k.Iter[TsSample]) error {
+			type named struct {
+				name string
+				p    Partitioner
+			}
+			resolved := make(map[string]named)
+			var dedup *batchDedup = batchDedupNew(nil)
+			var batches []s2k.Batch
+			for o := many(); o.HasValue(); o = many() {
+				var ts TsSample = o.Value()
+				n, ok := resolved[ts.id]
+				if !ok {
+					name, found, e := parts.resolve(ctx, policy, ts.id)
+					if nil != e {
+						return e
+					}
+					n = named{name: name, p: found}
+					resolved[ts.id] = n
+					batches = append(batches, s2k.BatchNew(PolicyBucket, []byte(ts.id), []byte(name)))
+				}
+				batches = dedup.appendNamed(batches, ts, n.p.Label, n.name)
+			}
+			var createOrIgnore = s2k.IterFromArray(batches).IntoInspect(func(b s2k.Batch) {
+				_ = fastAdder(ctx, b.Bucket()) // unable to create missing table -> query will be rejected anyway
+			})
+			return setter(ctx, createOrIgnore)
+		}
+	}
+}
+
+// intervalOf gets [start, end) of the partition using the current partitioner
+// or the partitioner name recorded in dates_<id>.
+// Partitions of unknown partitioners are reported as not found.
+func intervalOf(ctx context.Context, get s2k.Get, id, label string, current Partitioner, parts Partitioners) (start, end time.Time, found bool, e error) {
+	start, end, e = current.Interval(label)
+	if nil == e && label == current.Label(start) {
+		return start, end, true, nil
+	}
+	name, e := get(ctx, newDatesName(id), []byte(label))
+	if errors.Is(e, sql.ErrNoRows) || (nil == e && 0 == len(name)) {
+		return start, end, false, nil
+	}
+	if nil != e {
+		return start, end, false, e
+	}
+	p, e := parts.Get(string(name))
+	if nil != e {
+		return start, end, false, e
+	}
+	start, end, e = p.Interval(label)
+	return start, end, nil == e, e
+}
+
+// NewPolicyRangeScanner creates a scanner which resolves the partitioner of each device using the policy.
+// Partitions created using other partitioners(before the policy changed) are also scanned.
+func NewPolicyRangeScanner(lst s2k.Lst, get s2k.Get) func(policy PartitionPolicy, parts Partitioners) RangeScan {
+	return func(policy PartitionPolicy, parts Partitioners) RangeScan {
+		return func(ctx context.Context, id string, start, end time.Time, f func(partition []TsSample) bool) error {
+			_, current, e := parts.resolve(ctx, policy, id)
+			if nil != e {
+				return e
+			}
+			labels, e := CatalogNew(lst).DatesOf(ctx, id)
+			if nil != e {
+				return e
+			}
+
+			type partition struct {
+				label string
+				start time.Time
+			}
+			var overlapped []partition
+			for _, label := range labels {
+				pstart, pend, found, e := intervalOf(ctx, get, id, label, current, parts)
+				if nil != e {
+					return e
+				}
+				if found && pstart.Before(end) && pend.After(start) {
+					overlapped = append(overlapped, partition{label: label, start: pstart})
+				}
+			}
+			sort.SliceStable(overlapped, func(i, j int) bool { return overlapped[i].start.Before(overlapped[j].start) })
+
+			for _, o := range overlapped {
+				s, e := readPartition(ctx, lst, get, id, o.start, o.label)
+				if nil != e {
+					return e
+				}
+				if !f(s) {
+					return nil
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// NewPolicyRangeReader creates a reader which resolves the partitioner of each device using the policy(see NewPolicyRangeScanner).
+func NewPolicyRangeReader(lst s2k.Lst, get s2k.Get) func(policy PartitionPolicy, parts Partitioners) RangeRead {
+	return func(policy PartitionPolicy, parts Partitioners) RangeRead {
+		return NewPolicyRangeScanner(lst, get)(policy, parts).AsRangeRead()
+	}
+}
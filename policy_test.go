@@ -0,0 +1,143 @@
+package stdb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+func TestPolicy(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 0, time.UTC)
+	var policy PartitionPolicy = MapPolicyNew(map[string]string{"fast": "hour"}, "day")
+
+	t.Run("NewPolicyBatchSetter", func(t *testing.T) {
+		t.Parallel()
+
+		kv := memKvNew()
+		var bset BatchSet = NewPolicyBatchSetter(kv.AddBucket, kv.SetBatch)(policy, DefaultPartitioners)
+		e := bset(context.Background(), s2k.IterFromArray([]TsSample{
+			TsSampleNew("fast", dt, []byte("a"), []byte("0")),
+			TsSampleNew("fast", dt.Add(time.Hour), []byte("b"), []byte("1")),
+			TsSampleNew("slow", dt, []byte("c"), []byte("2")),
+		}))
+		if nil != e {
+			t.Fatalf("Unable to set: %v", e)
+		}
+
+		var cat Catalog = CatalogNew(kv.Lst)
+		dates, e := cat.DatesOf(context.Background(), "fast")
+		if nil != e {
+			t.Fatalf("Unable to list dates: %v", e)
+		}
+		checker(2, len(dates), t)
+		checker("2022082613", dates[0], t)
+
+		dates, e = cat.DatesOf(context.Background(), "slow")
+		if nil != e {
+			t.Fatalf("Unable to list dates: %v", e)
+		}
+		checker(1, len(dates), t)
+		checker("20220826", dates[0], t)
+
+		t.Run("NewPolicyRangeReader", func(t *testing.T) {
+			t.Parallel()
+
+			// readers do not need the original policy
+			var read RangeRead = NewPolicyRangeReader(kv.Lst, kv.Get)(
+				IndexPolicyNew(kv.Get, "day"),
+				DefaultPartitioners,
+			)
+
+			i, e := read(context.Background(), "fast", dt.Add(time.Hour), dt.Add(2*time.Hour))
+			if nil != e {
+				t.Fatalf("Unable to read: %v", e)
+			}
+			var samples []TsSample = i.ToArray()
+			checker(1, len(samples), t)
+			checker("1", string(samples[0].AsVal()), t)
+
+			i, e = read(context.Background(), "slow", dt, dt.Add(time.Hour))
+			if nil != e {
+				t.Fatalf("Unable to read: %v", e)
+			}
+			checker(uint64(1), i.Count(), t)
+		})
+	})
+
+	t.Run("policy changed", func(t *testing.T) {
+		t.Parallel()
+
+		kv := memKvNew()
+		write := func(policy PartitionPolicy, samples ...TsSample) {
+			t.Helper()
+			e := NewPolicyBatchSetter(kv.AddBucket, kv.SetBatch)(policy, DefaultPartitioners)(
+				context.Background(), s2k.IterFromArray(samples),
+			)
+			if nil != e {
+				t.Fatalf("Unable to set: %v", e)
+			}
+		}
+		write(StaticPolicyNew("day"), TsSampleNew("i3776", dt.Add(-24*time.Hour), []byte("a"), []byte("0")))
+		write(StaticPolicyNew("hour"), TsSampleNew("i3776", dt, []byte("b"), []byte("1")))
+
+		var read RangeRead = NewPolicyRangeReader(kv.Lst, kv.Get)(IndexPolicyNew(kv.Get, "day"), DefaultPartitioners)
+		i, e := read(context.Background(), "i3776", dt.Add(-48*time.Hour), dt.Add(time.Hour))
+		if nil != e {
+			t.Fatalf("Unable to read: %v", e)
+		}
+		var samples []TsSample = i.ToArray()
+		checker(2, len(samples), t)
+		checker("0", string(samples[0].AsVal()), t)
+		checker("1", string(samples[1].AsVal()), t)
+
+		i, e = read(context.Background(), "i3776", dt, dt.Add(time.Hour))
+		if nil != e {
+			t.Fatalf("Unable to read: %v", e)
+		}
+		checker(uint64(1), i.Count(), t)
+	})
+
+	t.Run("NewPolicySetter", func(t *testing.T) {
+		t.Parallel()
+
+		kv := memKvNew()
+		var set Set = NewPolicySetter(kv.AddBucket, kv.Set)(policy, DefaultPartitioners, &SimpleCommandRunner{})
+		e := set(context.Background(), "fast", dt, []byte("a"), []byte("0"))
+		if nil != e {
+			t.Fatalf("Unable to set: %v", e)
+		}
+
+		name, e := IndexPolicyNew(kv.Get, "day")(context.Background(), "fast")
+		if nil != e {
+			t.Fatalf("Unable to get policy: %v", e)
+		}
+		checker("hour", name, t)
+
+		name2, _ := kv.Get(context.Background(), "dates_fast", []byte("2022082613"))
+		checker("hour", string(name2), t)
+
+		set = NewPolicySetter(kv.AddBucket, kv.Set)(StaticPolicyNew("minute"), DefaultPartitioners, &SimpleCommandRunner{})
+		e = set(context.Background(), "fast", dt, []byte("a"), []byte("0"))
+		if nil == e {
+			t.Errorf("Must fail(unknown partitioner)")
+		}
+	})
+
+	t.Run("BucketPolicyNew", func(t *testing.T) {
+		t.Parallel()
+
+		var get s2k.Get = func(_ context.Context, _ string, _ []byte) ([]byte, error) {
+			return nil, sql.ErrNoRows
+		}
+		name, e := BucketPolicyNew(get, "config", "month")(context.Background(), "i3776")
+		if nil != e {
+			t.Fatalf("Missing device must use the fallback: %v", e)
+		}
+		checker("month", name, t)
+	})
+}
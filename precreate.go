@@ -0,0 +1,94 @@
+package stdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+// PreCreate creates buckets of upcoming partitions for known devices.
+type PreCreate func(ctx context.Context, now time.Time) error
+
+// upcomingLabels gets labels of the next n partitions after the partition of now.
+func upcomingLabels(p Partitioner, now time.Time, n int) ([]string, error) {
+	var labels []string
+	var t time.Time = now
+	for i := 0; i < n; i++ {
+		var label string = p.Label(t)
+		_, end, e := p.Interval(label)
+		if nil != e {
+			return nil, e
+		}
+		if !end.After(t) {
+			return nil, fmt.Errorf("Invalid partition(%s): %v", label, end)
+		}
+		t = end
+		labels = append(labels, p.Label(t))
+	}
+	return labels, nil
+}
+
+// NewPreCreator creates buckets(devices_<label>, data_<label>_<id>) of the next n partitions.
+// Devices are listed from the devices bucket and the partitioner of each device is resolved by the policy.
+// Use the adder shared with setters(e.g. FastBucketAdderNew) to warm its cache.
+func NewPreCreator(lst s2k.Lst, fastAdder s2k.AddBucket) func(policy PartitionPolicy, parts Partitioners, n int) PreCreate {
+	return func(policy PartitionPolicy, parts Partitioners, n int) PreCreate {
+		return func(ctx context.Context, now time.Time) error {
+			devices, e := CatalogNew(lst).Devices(ctx)
+			if nil != e {
+				return e
+			}
+			upcoming := make(map[string][]string) // partitioner name -> labels
+			created := make(map[string]struct{})  // devices_<label>
+			for _, id := range devices {
+				name, p, e := parts.resolve(ctx, policy, id)
+				if nil != e {
+					return e
+				}
+				labels, ok := upcoming[name]
+				if !ok {
+					labels, e = upcomingLabels(p, now, n)
+					if nil != e {
+						return e
+					}
+					upcoming[name] = labels
+				}
+				for _, label := range labels {
+					if _, ok := created[label]; !ok {
+						e = fastAdder(ctx, newDevicesName(label))
+						if nil != e {
+							return e
+						}
+						created[label] = struct{}{}
+					}
+					e = fastAdder(ctx, newStName(id, label))
+					if nil != e {
+						return e
+					}
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// RunPreCreator calls the pre creator for each tick until the context is done or the ticks are closed.
+// Errors are passed to onErr(the loop continues).
+func RunPreCreator(ctx context.Context, pre PreCreate, ticks <-chan time.Time, onErr func(error)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now, ok := <-ticks:
+			if !ok {
+				return nil
+			}
+			e := pre(ctx, now)
+			if nil != e {
+				onErr(e)
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package stdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+func TestPreCreator(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 0, time.UTC)
+
+	kvNew := func(t *testing.T) *memKv {
+		kv := memKvNew()
+		e := NewBatchSetter(kv.AddBucket, kv.SetBatch, 1024)(YmdConverter)(context.Background(), s2k.IterFromArray([]TsSample{
+			TsSampleNew("a", dt, []byte("k"), []byte("v")),
+			TsSampleNew("b", dt, []byte("k"), []byte("v")),
+		}))
+		if nil != e {
+			t.Fatalf("Unable to set: %v", e)
+		}
+		return kv
+	}
+
+	t.Run("next 2 days", func(t *testing.T) {
+		t.Parallel()
+
+		kv := kvNew(t)
+		var cache *BucketCache = BucketCacheNew()
+		var pre PreCreate = NewPreCreator(kv.Lst, cache.AsAdder(kv.AddBucket))(StaticPolicyNew("day"), DefaultPartitioners, 2)
+		e := pre(context.Background(), dt)
+		if nil != e {
+			t.Fatalf("Unable to pre create: %v", e)
+		}
+
+		for _, bucket := range []string{
+			"devices_20220827", "data_20220827_a", "data_20220827_b",
+			"devices_20220828", "data_20220828_a", "data_20220828_b",
+		} {
+			_, ok := kv.buckets[bucket]
+			checker(true, ok, t)
+			checker(true, cache.Has(bucket), t)
+		}
+		checker(6, cache.Len(), t)
+
+		// partitions after the next 2 days are not created
+		_, ok := kv.buckets["data_20220829_a"]
+		checker(false, ok, t)
+	})
+
+	t.Run("policy", func(t *testing.T) {
+		t.Parallel()
+
+		kv := kvNew(t)
+		var policy PartitionPolicy = MapPolicyNew(map[string]string{"a": "hour"}, "day")
+		e := NewPreCreator(kv.Lst, kv.AddBucket)(policy, DefaultPartitioners, 1)(context.Background(), dt)
+		if nil != e {
+			t.Fatalf("Unable to pre create: %v", e)
+		}
+
+		for _, bucket := range []string{
+			"devices_2022082614", "data_2022082614_a",
+			"devices_20220827", "data_20220827_b",
+		} {
+			_, ok := kv.buckets[bucket]
+			checker(true, ok, t)
+		}
+		_, ok := kv.buckets["data_20220827_a"]
+		checker(false, ok, t)
+
+		e = NewPreCreator(kv.Lst, kv.AddBucket)(StaticPolicyNew("minute"), DefaultPartitioners, 1)(context.Background(), dt)
+		if nil == e {
+			t.Errorf("Must fail(unknown partitioner)")
+		}
+	})
+
+	t.Run("adder error", func(t *testing.T) {
+		t.Parallel()
+
+		kv := kvNew(t)
+		var pre PreCreate = NewPreCreator(kv.Lst, func(_ context.Context, _ string) error {
+			return fmt.Errorf("Must fail")
+		})(StaticPolicyNew("day"), DefaultPartitioners, 1)
+		if nil == pre(context.Background(), dt) {
+			t.Errorf("Must fail")
+		}
+	})
+
+	t.Run("ticker", func(t *testing.T) {
+		t.Parallel()
+
+		kv := kvNew(t)
+		var pre PreCreate = NewPreCreator(kv.Lst, kv.AddBucket)(StaticPolicyNew("hour"), DefaultPartitioners, 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		ticks := make(chan time.Time)
+		done := make(chan error)
+		go func() { done <- RunPreCreator(ctx, pre, ticks, func(e error) { t.Errorf("Unexpected error: %v", e) }) }()
+
+		ticks <- dt
+		ticks <- dt.Add(time.Hour)
+		cancel()
+		e := <-done
+		checker(true, errors.Is(e, context.Canceled), t)
+
+		_, ok := kv.buckets["data_2022082614_a"]
+		checker(true, ok, t)
+		_, ok = kv.buckets["data_2022082615_b"]
+		checker(true, ok, t)
+	})
+
+	t.Run("closed ticks", func(t *testing.T) {
+		t.Parallel()
+
+		kv := kvNew(t)
+		var pre PreCreate = NewPreCreator(kv.Lst, kv.AddBucket)(StaticPolicyNew("hour"), DefaultPartitioners, 1)
+
+		ticks := make(chan time.Time)
+		close(ticks)
+		e := RunPreCreator(context.Background(), pre, ticks, func(e error) { t.Errorf("Unexpected error: %v", e) })
+		checker(nil, e, t)
+	})
+}
@@ -0,0 +1,331 @@
+// Package prom receives samples from Prometheus remote write.
+package prom
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	"github.com/takanoriyanagitani/go-spacetimedb/internal/pbwire"
+	tskey "github.com/takanoriyanagitani/go-spacetimedb/key"
+)
+
+// LabelBucket records the label set of each series(key: id, val: json object).
+const LabelBucket = "prom_labels"
+
+const (
+	defaultMaxBytes  int64 = 32 << 20
+	defaultBatchSize int   = 1024
+)
+
+// field numbers(see prometheus/prompb)
+const (
+	fieldTimeseries protowire.Number = 1
+
+	fieldLabels  protowire.Number = 1
+	fieldSamples protowire.Number = 2
+
+	fieldName  protowire.Number = 1
+	fieldValue protowire.Number = 2
+
+	fieldSampleValue     protowire.Number = 1
+	fieldSampleTimestamp protowire.Number = 2
+)
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	Value     float64
+	Timestamp int64 // unix millis
+}
+
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+type WriteRequest struct {
+	Timeseries []TimeSeries
+}
+
+func (l *Label) unmarshal(b []byte) error {
+	return pbwire.ConsumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if protowire.BytesType != typ || (fieldName != num && fieldValue != num) {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if fieldName == num {
+			l.Name = string(v)
+		} else {
+			l.Value = string(v)
+		}
+		return n, nil
+	})
+}
+
+func (s *Sample) unmarshal(b []byte) error {
+	return pbwire.ConsumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case fieldSampleValue == num && protowire.Fixed64Type == typ:
+			v, n := protowire.ConsumeFixed64(b)
+			s.Value = math.Float64frombits(v)
+			return n, nil
+		case fieldSampleTimestamp == num && protowire.VarintType == typ:
+			v, n := protowire.ConsumeVarint(b)
+			s.Timestamp = int64(v)
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
+
+func (t *TimeSeries) unmarshal(b []byte) error {
+	return pbwire.ConsumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case fieldLabels:
+			return pbwire.ConsumeMessage(typ, b, func(msg []byte) error {
+				var l Label
+				e := l.unmarshal(msg)
+				t.Labels = append(t.Labels, l)
+				return e
+			})
+		case fieldSamples:
+			return pbwire.ConsumeMessage(typ, b, func(msg []byte) error {
+				var s Sample
+				e := s.unmarshal(msg)
+				t.Samples = append(t.Samples, s)
+				return e
+			})
+		}
+		// exemplars, histograms: not supported
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
+
+// UnmarshalMessage parses a (decompressed) WriteRequest message.
+// Metadata, exemplars and native histograms are skipped.
+func (w *WriteRequest) UnmarshalMessage(b []byte) error {
+	return pbwire.ConsumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if fieldTimeseries != num {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+		return pbwire.ConsumeMessage(typ, b, func(msg []byte) error {
+			var t TimeSeries
+			e := t.unmarshal(msg)
+			w.Timeseries = append(w.Timeseries, t)
+			return e
+		})
+	})
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// AppendMessage appends the WriteRequest message(without compression).
+func (w *WriteRequest) AppendMessage(b []byte) []byte {
+	for _, t := range w.Timeseries {
+		var ts []byte
+		for _, l := range t.Labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, fieldName, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Name)
+			lb = protowire.AppendTag(lb, fieldValue, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Value)
+			ts = appendMessage(ts, fieldLabels, lb)
+		}
+		for _, s := range t.Samples {
+			var sb []byte
+			sb = protowire.AppendTag(sb, fieldSampleValue, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(s.Value))
+			sb = protowire.AppendTag(sb, fieldSampleTimestamp, protowire.VarintType)
+			sb = protowire.AppendVarint(sb, uint64(s.Timestamp))
+			ts = appendMessage(ts, fieldSamples, sb)
+		}
+		b = appendMessage(b, fieldTimeseries, ts)
+	}
+	return b
+}
+
+// SeriesId gets the device id of the label set(32 hex digits).
+// The id does not depend on the order of the labels.
+func SeriesId(labels []Label) string {
+	sorted := append([]Label(nil), labels...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	h := sha256.New()
+	for _, l := range sorted {
+		_, _ = io.WriteString(h, l.Name)
+		_, _ = h.Write([]byte{0xff})
+		_, _ = io.WriteString(h, l.Value)
+		_, _ = h.Write([]byte{0xff})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func labelsJson(labels []Label) ([]byte, error) {
+	m := make(map[string]string, len(labels))
+	for _, l := range labels {
+		m[l.Name] = l.Value
+	}
+	return json.Marshal(m) // keys are sorted
+}
+
+// SampleKey encodes the timestamp(order preserving).
+func SampleKey(timestamp int64) []byte {
+	return tskey.Time(time.UnixMilli(timestamp))
+}
+
+// ToSamples converts the series.
+//
+//	key: timestamp(tskey.Time)
+//	val: value(stdb.Float64Codec)
+func (t *TimeSeries) ToSamples() (samples []sp.TsSample, e error) {
+	var id string = SeriesId(t.Labels)
+	for _, s := range t.Samples {
+		val, e := sp.Float64Codec.Encode(s.Value)
+		if nil != e {
+			return nil, e
+		}
+		var date time.Time = time.UnixMilli(s.Timestamp).UTC()
+		samples = append(samples, sp.TsSampleNew(id, date, SampleKey(s.Timestamp), val))
+	}
+	return samples, nil
+}
+
+type receiver struct {
+	bset      sp.BatchSet
+	adder     s2k.AddBucket
+	set       s2k.Set
+	known     *sp.IndexCache // ids in the label bucket
+	maxBytes  int64
+	batchSize int
+}
+
+type ReceiverOption func(r *receiver)
+
+// KnownSeries sets the cache of series already recorded in the LabelBucket.
+// Labels are recorded for each request if the cache is nil.
+func KnownSeries(cache *sp.IndexCache) ReceiverOption {
+	return func(r *receiver) { r.known = cache }
+}
+
+func WithMaxBytes(n int64) ReceiverOption {
+	return func(r *receiver) { r.maxBytes = n }
+}
+
+// WithBatchSize limits the number of samples written by a BatchSet call(default: 1024).
+// The limit of the batch setter must be sp.BatchesPerSample times the size or more.
+func WithBatchSize(n int) ReceiverOption {
+	return func(r *receiver) { r.batchSize = n }
+}
+
+func (r *receiver) recordLabels(ctx context.Context, req *WriteRequest) error {
+	for _, t := range req.Timeseries {
+		var id string = SeriesId(t.Labels)
+		if nil != r.known && r.known.Has(id) {
+			continue
+		}
+		val, e := labelsJson(t.Labels)
+		if nil != e {
+			return e
+		}
+		e = r.adder(ctx, LabelBucket)
+		if nil != e {
+			return e
+		}
+		e = r.set(ctx, LabelBucket, []byte(id), val)
+		if nil != e {
+			return e
+		}
+		if nil != r.known {
+			r.known.Add(id)
+		}
+	}
+	return nil
+}
+
+// ReceiverNew creates a handler for Prometheus remote write(protobuf, snappy block format).
+// Label sets are recorded in the LabelBucket using the adder/set.
+func ReceiverNew(bset sp.BatchSet, adder s2k.AddBucket, set s2k.Set, opts ...ReceiverOption) http.Handler {
+	rcv := &receiver{
+		bset:      bset,
+		adder:     adder,
+		set:       set,
+		known:     sp.IndexCacheNew(65536),
+		maxBytes:  defaultMaxBytes,
+		batchSize: defaultBatchSize,
+	}
+	for _, opt := range opts {
+		opt(rcv)
+	}
+	var write sp.BatchSet = sp.ChunkedBatchSet(rcv.bset, rcv.batchSize)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodPost != r.Method {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		compressed, e := io.ReadAll(http.MaxBytesReader(w, r.Body, rcv.maxBytes))
+		if nil != e {
+			http.Error(w, "Unable to read the body", http.StatusBadRequest)
+			return
+		}
+		if n, e := snappy.DecodedLen(compressed); nil != e || rcv.maxBytes < int64(n) {
+			http.Error(w, "Invalid snappy body", http.StatusBadRequest)
+			return
+		}
+		raw, e := snappy.Decode(nil, compressed)
+		if nil != e {
+			http.Error(w, fmt.Sprintf("Invalid snappy body: %v", e), http.StatusBadRequest)
+			return
+		}
+		var req WriteRequest
+		e = req.UnmarshalMessage(raw)
+		if nil != e {
+			http.Error(w, fmt.Sprintf("Invalid write request: %v", e), http.StatusBadRequest)
+			return
+		}
+
+		var samples []sp.TsSample
+		for _, t := range req.Timeseries {
+			s, e := t.ToSamples()
+			if nil != e {
+				http.Error(w, e.Error(), http.StatusBadRequest)
+				return
+			}
+			samples = append(samples, s...)
+		}
+
+		e = rcv.recordLabels(r.Context(), &req)
+		if nil != e {
+			http.Error(w, fmt.Sprintf("Unable to record labels: %v", e), http.StatusInternalServerError)
+			return
+		}
+		if 0 < len(samples) {
+			e = write(r.Context(), s2k.IterFromArray(samples))
+			if nil != e {
+				http.Error(w, fmt.Sprintf("Unable to write: %v", e), http.StatusInternalServerError)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,202 @@
+package prom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	tskey "github.com/takanoriyanagitani/go-spacetimedb/key"
+	vlcb "github.com/takanoriyanagitani/go-spacetimedb/vlog/cbor"
+)
+
+func checker[T comparable](t *testing.T, got T, expected T) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("Unexpected value got.\n")
+		t.Errorf("expected: %v\n", expected)
+		t.Errorf("got:      %v\n", got)
+	}
+}
+
+type store struct {
+	samples []vlcb.SampleDto
+	labels  map[string][]byte
+	sets    int
+	writes  int
+}
+
+func (s *store) BatchSet(_ context.Context, many s2k.Iter[sp.TsSample]) error {
+	s.writes += 1
+	for o := many(); o.HasValue(); o = many() {
+		var dto vlcb.SampleDto
+		o.Value().ForUser(&dto)
+		s.samples = append(s.samples, dto)
+	}
+	return nil
+}
+
+func (s *store) AddBucket(_ context.Context, _ string) error { return nil }
+
+func (s *store) Set(_ context.Context, bucket string, key, val []byte) error {
+	if LabelBucket != bucket {
+		return fmt.Errorf("Unexpected bucket: %s", bucket)
+	}
+	s.sets += 1
+	s.labels[string(key)] = val
+	return nil
+}
+
+func send(h http.Handler, req *WriteRequest) *httptest.ResponseRecorder {
+	var body []byte = snappy.Encode(nil, req.AppendMessage(nil))
+	hr := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+	hr.Header.Set("Content-Encoding", "snappy")
+	hr.Header.Set("Content-Type", "application/x-protobuf")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, hr)
+	return rec
+}
+
+func TestReceiver(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 678000000, time.UTC)
+	up := []Label{{"__name__", "up"}, {"job", "node"}, {"instance", "a:9100"}}
+
+	req := &WriteRequest{Timeseries: []TimeSeries{
+		{
+			Labels: up,
+			Samples: []Sample{
+				{Value: 1, Timestamp: dt.UnixMilli()},
+				{Value: 0, Timestamp: dt.Add(15 * time.Second).UnixMilli()},
+			},
+		},
+		{
+			Labels:  []Label{{"__name__", "up"}, {"job", "node"}, {"instance", "b:9100"}},
+			Samples: []Sample{{Value: 1, Timestamp: dt.UnixMilli()}},
+		},
+	}}
+
+	t.Run("write", func(t *testing.T) {
+		t.Parallel()
+
+		s := &store{labels: make(map[string][]byte)}
+		var h http.Handler = ReceiverNew(s.BatchSet, s.AddBucket, s.Set)
+
+		rec := send(h, req)
+		checker(t, rec.Code, http.StatusNoContent)
+		checker(t, len(s.samples), 3)
+
+		var id string = SeriesId(up)
+		checker(t, s.samples[0].Id, id)
+		checker(t, s.samples[0].Date.Equal(dt), true)
+
+		tm, e := tskey.TimeDecode(s.samples[0].Key)
+		if nil != e {
+			t.Fatalf("Invalid key: %v", e)
+		}
+		checker(t, tm.Equal(dt), true)
+		checker(t, bytes.Compare(s.samples[0].Key, s.samples[1].Key), -1)
+
+		val, e := sp.Float64Codec.Decode(s.samples[0].Val)
+		if nil != e {
+			t.Fatalf("Invalid val: %v", e)
+		}
+		checker(t, val, 1.0)
+
+		var labels map[string]string
+		e = json.Unmarshal(s.labels[id], &labels)
+		if nil != e {
+			t.Fatalf("Invalid labels: %v", e)
+		}
+		checker(t, labels["instance"], "a:9100")
+		checker(t, len(s.labels), 2)
+
+		// known series are not recorded again
+		rec = send(h, req)
+		checker(t, rec.Code, http.StatusNoContent)
+		checker(t, s.sets, 2)
+	})
+
+	t.Run("no cache", func(t *testing.T) {
+		t.Parallel()
+
+		s := &store{labels: make(map[string][]byte)}
+		var h http.Handler = ReceiverNew(s.BatchSet, s.AddBucket, s.Set, KnownSeries(nil))
+		for i := 0; i < 2; i++ {
+			rec := send(h, req)
+			checker(t, rec.Code, http.StatusNoContent)
+		}
+		checker(t, s.sets, 4)
+	})
+
+	t.Run("batch size", func(t *testing.T) {
+		t.Parallel()
+
+		s := &store{labels: make(map[string][]byte)}
+		var h http.Handler = ReceiverNew(s.BatchSet, s.AddBucket, s.Set, WithBatchSize(2))
+		rec := send(h, req)
+		checker(t, rec.Code, http.StatusNoContent)
+		checker(t, len(s.samples), 3)
+		checker(t, s.writes, 2)
+	})
+
+	t.Run("stable id", func(t *testing.T) {
+		t.Parallel()
+
+		reordered := []Label{up[2], up[0], up[1]}
+		checker(t, SeriesId(reordered), SeriesId(up))
+		checker(t, SeriesId(up[:2]) == SeriesId(up), false)
+		checker(t, len(SeriesId(up)), 32)
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		var decoded WriteRequest
+		e := decoded.UnmarshalMessage(req.AppendMessage(nil))
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(t, len(decoded.Timeseries), 2)
+		checker(t, decoded.Timeseries[0].Labels[2], up[2])
+		checker(t, decoded.Timeseries[0].Samples[1], req.Timeseries[0].Samples[1])
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		t.Parallel()
+
+		s := &store{labels: make(map[string][]byte)}
+		var h http.Handler = ReceiverNew(s.BatchSet, s.AddBucket, s.Set)
+
+		hr := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader([]byte("not snappy")))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, hr)
+		checker(t, rec.Code, http.StatusBadRequest)
+
+		rec = httptest.NewRecorder()
+		hr = httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(snappy.Encode(nil, []byte{0x0a, 0x05})))
+		h.ServeHTTP(rec, hr)
+		checker(t, rec.Code, http.StatusBadRequest)
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		t.Parallel()
+
+		s := &store{labels: make(map[string][]byte)}
+		var h http.Handler = ReceiverNew(func(_ context.Context, _ s2k.Iter[sp.TsSample]) error {
+			return fmt.Errorf("Must fail")
+		}, s.AddBucket, s.Set)
+		rec := send(h, req)
+		checker(t, rec.Code, http.StatusInternalServerError)
+	})
+}
@@ -0,0 +1,138 @@
+package stdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+type PartitionRead func(ctx context.Context, id string, date time.Time) (s2k.Iter[TsSample], error)
+type DayRead func(ctx context.Context, date time.Time) (s2k.Iter[TsSample], error)
+
+// PartitionRangeRead gets samples whose keys are in [lo, hi). nil means unbounded.
+type PartitionRangeRead func(ctx context.Context, id string, date time.Time, lo, hi []byte) (s2k.Iter[TsSample], error)
+
+var errRangeEnd = errors.New("end of range")
+
+func lstStrings(ctx context.Context, lst s2k.Lst, bucket string) (s []string, e error) {
+	e = lst(ctx, bucket, func(key []byte) error {
+		s = append(s, string(key))
+		return nil
+	})
+	return
+}
+
+type Catalog struct {
+	lst s2k.Lst
+}
+
+func CatalogNew(lst s2k.Lst) Catalog { return Catalog{lst} }
+
+func (c Catalog) Devices(ctx context.Context) ([]string, error) {
+	return lstStrings(ctx, c.lst, "devices")
+}
+
+func (c Catalog) Dates(ctx context.Context) ([]string, error) {
+	return lstStrings(ctx, c.lst, "dates")
+}
+
+// DatesOf lists the partition labels which have samples of the device.
+func (c Catalog) DatesOf(ctx context.Context, id string) ([]string, error) {
+	return lstStrings(ctx, c.lst, newDatesName(id))
+}
+
+// DevicesOn lists the devices which have samples in the partition.
+func (c Catalog) DevicesOn(ctx context.Context, dtymd string) ([]string, error) {
+	return lstStrings(ctx, c.lst, newDevicesName(dtymd))
+}
+
+func lstRange(ctx context.Context, lst s2k.Lst, bucket string, lo, hi []byte) (keys [][]byte, e error) {
+	var ended bool = false
+	e = lst(ctx, bucket, func(key []byte) error {
+		if nil != hi && 0 <= bytes.Compare(key, hi) {
+			ended = true
+			return errRangeEnd // keys are ordered
+		}
+		if nil == lo || 0 <= bytes.Compare(key, lo) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if ended {
+		// the error may not wrap errRangeEnd
+		return keys, nil
+	}
+	return
+}
+
+func readPartition(ctx context.Context, lst s2k.Lst, get s2k.Get, id string, date time.Time, dtymd string) ([]TsSample, error) {
+	return readPartitionRange(ctx, lst, get, id, date, dtymd, nil, nil)
+}
+
+func readPartitionRange(ctx context.Context, lst s2k.Lst, get s2k.Get, id string, date time.Time, dtymd string, lo, hi []byte) ([]TsSample, error) {
+	var stname string = newStName(id, dtymd)
+	keys, e := lstRange(ctx, lst, stname, lo, hi)
+	if nil != e {
+		return nil, e
+	}
+	samples := make([]TsSample, 0, len(keys))
+	for _, key := range keys {
+		val, e := get(ctx, stname, key)
+		if nil != e {
+			return nil, e
+		}
+		samples = append(samples, TsSampleNew(id, date, key, val))
+	}
+	return samples, nil
+}
+
+// NewPartitionReader creates a reader which gets all samples(ordered by key) in data_<ymd>_<id>.
+// The date of the samples will be the date used to find the partition.
+func NewPartitionReader(lst s2k.Lst, get s2k.Get) func(dateConverter Date2Str) PartitionRead {
+	return func(dateConverter Date2Str) PartitionRead {
+		return func(ctx context.Context, id string, date time.Time) (s2k.Iter[TsSample], error) {
+			samples, e := readPartition(ctx, lst, get, id, date, dateConverter(date))
+			if nil != e {
+				return nil, e
+			}
+			return s2k.IterFromArray(samples), nil
+		}
+	}
+}
+
+func NewPartitionRangeReader(lst s2k.Lst, get s2k.Get) func(dateConverter Date2Str) PartitionRangeRead {
+	return func(dateConverter Date2Str) PartitionRangeRead {
+		return func(ctx context.Context, id string, date time.Time, lo, hi []byte) (s2k.Iter[TsSample], error) {
+			samples, e := readPartitionRange(ctx, lst, get, id, date, dateConverter(date), lo, hi)
+			if nil != e {
+				return nil, e
+			}
+			return s2k.IterFromArray(samples), nil
+		}
+	}
+}
+
+// NewDayReader creates a reader which gets all samples of all devices found in devices_<ymd>.
+func NewDayReader(lst s2k.Lst, get s2k.Get) func(dateConverter Date2Str) DayRead {
+	return func(dateConverter Date2Str) DayRead {
+		return func(ctx context.Context, date time.Time) (s2k.Iter[TsSample], error) {
+			var dtymd string = dateConverter(date)
+			devices, e := CatalogNew(lst).DevicesOn(ctx, dtymd)
+			if nil != e {
+				return nil, e
+			}
+			var samples []TsSample
+			for _, id := range devices {
+				s, e := readPartition(ctx, lst, get, id, date, dtymd)
+				if nil != e {
+					return nil, e
+				}
+				samples = append(samples, s...)
+			}
+			return s2k.IterFromArray(samples), nil
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package stdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+type memKv struct {
+	lk      sync.Mutex
+	buckets map[string]map[string][]byte
+}
+
+func memKvNew() *memKv { return &memKv{buckets: make(map[string]map[string][]byte)} }
+
+func (m *memKv) AddBucket(_ context.Context, bucket string) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	if _, ok := m.buckets[bucket]; !ok {
+		m.buckets[bucket] = make(map[string][]byte)
+	}
+	return nil
+}
+
+func (m *memKv) Set(_ context.Context, bucket string, key, val []byte) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return fmt.Errorf("No such bucket: %s", bucket)
+	}
+	b[string(key)] = val
+	return nil
+}
+
+func (m *memKv) SetBatch(ctx context.Context, many s2k.Iter[s2k.Batch]) error {
+	for o := many(); o.HasValue(); o = many() {
+		var b s2k.Batch = o.Value()
+		e := m.Set(ctx, b.Bucket(), b.Pair().Key, b.Pair().Val)
+		if nil != e {
+			return e
+		}
+	}
+	return nil
+}
+
+func (m *memKv) Get(_ context.Context, bucket string, key []byte) ([]byte, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return nil, fmt.Errorf("No such bucket: %s", bucket)
+	}
+	return b[string(key)], nil
+}
+
+func (m *memKv) Lst(_ context.Context, bucket string, cb func(key []byte) error) error {
+	m.lk.Lock()
+	b, ok := m.buckets[bucket]
+	var keys []string
+	for k := range b {
+		keys = append(keys, k)
+	}
+	m.lk.Unlock()
+	if !ok {
+		return fmt.Errorf("No such bucket: %s", bucket)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e := cb([]byte(k))
+		if nil != e {
+			return e
+		}
+	}
+	return nil
+}
+
+func TestReader(t *testing.T) {
+	t.Parallel()
+
+	kv := memKvNew()
+	var dt time.Time = time.Date(2022, time.August, 26, 12, 0, 0, 0, time.UTC)
+	var bset BatchSet = NewBatchSetter(kv.AddBucket, kv.SetBatch, 16)(YmdConverter)
+	e := bset(context.Background(), s2k.IterFromArray([]TsSample{
+		TsSampleNew("i3776", dt, []byte("b"), []byte("2")),
+		TsSampleNew("i3776", dt, []byte("a"), []byte("1")),
+		TsSampleNew("i634", dt, []byte("c"), []byte("3")),
+	}))
+	if nil != e {
+		t.Fatalf("Unable to set: %v", e)
+	}
+
+	t.Run("Catalog", func(t *testing.T) {
+		t.Parallel()
+
+		var cat Catalog = CatalogNew(kv.Lst)
+
+		devices, e := cat.Devices(context.Background())
+		if nil != e {
+			t.Errorf("Unable to list devices: %v", e)
+		}
+		checker(2, len(devices), t)
+
+		dates, e := cat.DatesOf(context.Background(), "i634")
+		if nil != e {
+			t.Errorf("Unable to list dates: %v", e)
+		}
+		checker(1, len(dates), t)
+		checker("20220826", dates[0], t)
+
+		devices, e = cat.DevicesOn(context.Background(), "20220826")
+		if nil != e {
+			t.Errorf("Unable to list devices: %v", e)
+		}
+		checker(2, len(devices), t)
+	})
+
+	t.Run("NewPartitionReader", func(t *testing.T) {
+		t.Parallel()
+
+		var read PartitionRead = NewPartitionReader(kv.Lst, kv.Get)(YmdConverter)
+
+		t.Run("ordered", func(t *testing.T) {
+			t.Parallel()
+			i, e := read(context.Background(), "i3776", dt)
+			if nil != e {
+				t.Fatalf("Unable to read: %v", e)
+			}
+			var samples []TsSample = i.ToArray()
+			checker(2, len(samples), t)
+			checker(0, bytes.Compare(samples[0].AsKey(), []byte("a")), t)
+			checker(0, bytes.Compare(samples[1].AsVal(), []byte("2")), t)
+			checker(dt, samples[0].date, t)
+		})
+
+		t.Run("missing partition", func(t *testing.T) {
+			t.Parallel()
+			_, e := read(context.Background(), "i333", dt)
+			if nil == e {
+				t.Errorf("Must fail")
+			}
+		})
+	})
+
+	t.Run("NewPartitionRangeReader", func(t *testing.T) {
+		t.Parallel()
+
+		var read PartitionRangeRead = NewPartitionRangeReader(kv.Lst, kv.Get)(YmdConverter)
+
+		t.Run("bounded", func(t *testing.T) {
+			t.Parallel()
+			i, e := read(context.Background(), "i3776", dt, []byte("a"), []byte("b"))
+			if nil != e {
+				t.Fatalf("Unable to read: %v", e)
+			}
+			var samples []TsSample = i.ToArray()
+			checker(1, len(samples), t)
+			checker(0, bytes.Compare(samples[0].AsVal(), []byte("1")), t)
+		})
+
+		t.Run("unbounded", func(t *testing.T) {
+			t.Parallel()
+			i, e := read(context.Background(), "i3776", dt, []byte("b"), nil)
+			if nil != e {
+				t.Fatalf("Unable to read: %v", e)
+			}
+			checker(uint64(1), i.Count(), t)
+		})
+	})
+
+	t.Run("NewDayReader", func(t *testing.T) {
+		t.Parallel()
+
+		var read DayRead = NewDayReader(kv.Lst, kv.Get)(YmdConverter)
+		i, e := read(context.Background(), dt)
+		if nil != e {
+			t.Fatalf("Unable to read: %v", e)
+		}
+		checker(uint64(3), i.Count(), t)
+	})
+}
@@ -0,0 +1,488 @@
+package stdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+const rollupValueSize int = 48
+
+var rollupLevelName = regexp.MustCompile(`^[0-9a-z]{1,8}$`)
+
+// RollupLevel is an interval of rollups.
+// Rollups are stored in rollup_<name>_<label>_<id>(e.g. rollup_1h_20220826_cafef00d).
+type RollupLevel struct {
+	Name     string
+	Interval time.Duration
+}
+
+var (
+	Rollup1m RollupLevel = RollupLevel{Name: "1m", Interval: time.Minute}
+	Rollup1h RollupLevel = RollupLevel{Name: "1h", Interval: time.Hour}
+	Rollup1d RollupLevel = RollupLevel{Name: "1d", Interval: 24 * time.Hour}
+)
+
+func (l RollupLevel) validate() error {
+	if !rollupLevelName.MatchString(l.Name) {
+		return fmt.Errorf("Invalid rollup name: %s", l.Name)
+	}
+	if l.Interval <= 0 {
+		return fmt.Errorf("Invalid rollup interval: %v", l.Interval)
+	}
+	return nil
+}
+
+func newRollupName(level string, label string, id string) string {
+	return strings.Join([]string{"rollup", level, label, id}, "_")
+}
+
+// newRollupsName gets the bucket which lists partition labels of the rollups of the device.
+func newRollupsName(level string, id string) string {
+	return strings.Join([]string{"rollups", level, id}, "_")
+}
+
+// Rollup aggregates numeric values in [Start, Start+interval).
+type Rollup struct {
+	Start  time.Time
+	Count  uint64
+	Min    float64
+	Max    float64
+	Sum    float64
+	Last   float64
+	LastAt time.Time
+}
+
+func (r Rollup) Mean() float64 { return r.Sum / float64(r.Count) }
+
+func (r *Rollup) Add(t time.Time, v float64) {
+	r.Merge(Rollup{Count: 1, Min: v, Max: v, Sum: v, Last: v, LastAt: t})
+}
+
+// Merge adds the values of the other rollup(Start will not be changed).
+func (r *Rollup) Merge(o Rollup) {
+	if 0 == o.Count {
+		return
+	}
+	if 0 == r.Count {
+		var start time.Time = r.Start
+		*r = o
+		r.Start = start
+		return
+	}
+	r.Count += o.Count
+	r.Min = math.Min(r.Min, o.Min)
+	r.Max = math.Max(r.Max, o.Max)
+	r.Sum += o.Sum
+	if !o.LastAt.Before(r.LastAt) {
+		r.Last = o.Last
+		r.LastAt = o.LastAt
+	}
+}
+
+// rollupKey encodes the start of the interval(TimeCodec, same as tskey.Time).
+func rollupKey(start time.Time) []byte { return OrderedTime(start) }
+
+func rollupKeyDecode(key []byte) (time.Time, error) { return TimeCodec.Decode(key) }
+
+// encode: count, min, max, sum, last, last at(unix nanos)
+func (r Rollup) encode() []byte {
+	var b []byte = make([]byte, 0, rollupValueSize)
+	b = binary.BigEndian.AppendUint64(b, r.Count)
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(r.Min))
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(r.Max))
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(r.Sum))
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(r.Last))
+	return binary.BigEndian.AppendUint64(b, uint64(r.LastAt.UnixNano()))
+}
+
+func rollupDecode(start time.Time, b []byte) (Rollup, error) {
+	if rollupValueSize != len(b) {
+		return Rollup{}, fmt.Errorf("Invalid rollup(len=%v)", len(b))
+	}
+	u := func(i int) uint64 { return binary.BigEndian.Uint64(b[8*i:]) }
+	return Rollup{
+		Start:  start,
+		Count:  u(0),
+		Min:    math.Float64frombits(u(1)),
+		Max:    math.Float64frombits(u(2)),
+		Sum:    math.Float64frombits(u(3)),
+		Last:   math.Float64frombits(u(4)),
+		LastAt: time.Unix(0, int64(u(5))).UTC(),
+	}, nil
+}
+
+// SampleValue gets the time and the numeric value of a sample.
+type SampleValue func(s TsSample) (t time.Time, v float64, e error)
+
+// SampleValueNew creates a SampleValue which decodes values using the decoder(e.g. Float64Codec.Decode).
+// The time is decoded from the key using keyTime(e.g. tskey.TimeDecode) or the date of the sample if keyTime is nil.
+// Readers need keyTime because samples read from partitions have the start of the partition as the date.
+func SampleValueNew(dec Decoder[float64], keyTime func(key []byte) (time.Time, error)) SampleValue {
+	return func(s TsSample) (t time.Time, v float64, e error) {
+		t = s.date
+		if nil != keyTime {
+			t, e = keyTime(s.AsKey())
+			if nil != e {
+				return t, v, e
+			}
+		}
+		v, e = dec(s.AsVal())
+		return t, v, e
+	}
+}
+
+// rollupSet: start(unix nanos) -> rollup
+type rollupSet map[int64]*Rollup
+
+func (s rollupSet) add(interval time.Duration, t time.Time, v float64) {
+	var start time.Time = t.UTC().Truncate(interval)
+	r, ok := s[start.UnixNano()]
+	if !ok {
+		r = &Rollup{Start: start}
+		s[start.UnixNano()] = r
+	}
+	r.Add(t, v)
+}
+
+func (s rollupSet) sorted() []Rollup {
+	rollups := make([]Rollup, 0, len(s))
+	for _, r := range s {
+		rollups = append(rollups, *r)
+	}
+	sort.Slice(rollups, func(i, j int) bool { return rollups[i].Start.Before(rollups[j].Start) })
+	return rollups
+}
+
+// checkPartition rejects rollups which span partitions.
+func checkPartition(p Partitioner, level RollupLevel, rollups []Rollup) error {
+	for _, r := range rollups {
+		var label string = p.Label(r.Start)
+		if label != p.Label(r.Start.Add(level.Interval-1)) {
+			return fmt.Errorf("The rollup(%v) spans partitions: %s", r.Start, label)
+		}
+	}
+	return nil
+}
+
+func rollups2batch(p Partitioner, level RollupLevel, id string, rollups []Rollup) (batches []s2k.Batch) {
+	for _, r := range rollups {
+		batches = append(batches, s2k.BatchNew(newRollupName(level.Name, p.Label(r.Start), id), rollupKey(r.Start), r.encode()))
+	}
+	return
+}
+
+// rolledUpBatch marks the partition as rolled up(readers use rollups instead of raw samples).
+func rolledUpBatch(level RollupLevel, id string, label string) s2k.Batch {
+	return s2k.BatchNew(newRollupsName(level.Name, id), []byte(label), []byte(""))
+}
+
+// coveredBy checks if all keys in the bucket are in the keys.
+// Errors(e.g. missing bucket) are reported as not covered.
+func coveredBy(ctx context.Context, lst s2k.Lst, bucket string, keys map[string]struct{}) bool {
+	var covered bool = true
+	e := lst(ctx, bucket, func(key []byte) error {
+		if _, ok := keys[string(key)]; !ok {
+			covered = false
+			return errRangeEnd
+		}
+		return nil
+	})
+	return covered && nil == e
+}
+
+func setRollups(ctx context.Context, fastAdder s2k.AddBucket, setter s2k.SetBatch, batches []s2k.Batch) error {
+	if 0 == len(batches) {
+		return nil
+	}
+	var createOrIgnore = s2k.IterFromArray(batches).IntoInspect(func(b s2k.Batch) {
+		_ = fastAdder(ctx, b.Bucket())
+	})
+	return setter(ctx, createOrIgnore)
+}
+
+// NewRollupWriter creates a BatchSet which merges samples into the stored rollups(incremental).
+// Use it after the BatchSet of raw samples(e.g. WithRollups).
+// Intervals must not span partitions(e.g. 1d rollups of hour partitions).
+// Rollups are read-modify-written: a device must not be written concurrently,
+// and samples written twice are counted twice(use NewRollupJob to recompute).
+//
+// A partition is marked as rolled up only if all raw samples of the partition are in the batch
+// (the partition was created by the batch); partitions which have samples written before
+// the rollups are enabled are read from raw samples until NewRollupJob rolls them up.
+func NewRollupWriter(fastAdder s2k.AddBucket, lst s2k.Lst, get s2k.Get, setter s2k.SetBatch) func(p Partitioner, level RollupLevel, value SampleValue) BatchSet {
+	return func(p Partitioner, level RollupLevel, value SampleValue) BatchSet {
+		return func(ctx context.Context, many s2k.Iter[TsSample]) error {
+			e := level.validate()
+			if nil != e {
+				return e
+			}
+			var devices map[string]rollupSet = make(map[string]rollupSet)
+			var keys map[string]map[string]struct{} = make(map[string]map[string]struct{}) // data_<label>_<id> -> keys
+			for o := many(); o.HasValue(); o = many() {
+				var s TsSample = o.Value()
+				t, v, e := value(s)
+				if nil != e {
+					return fmt.Errorf("Invalid sample(id: %s): %v", s.id, e)
+				}
+				if _, ok := devices[s.id]; !ok {
+					devices[s.id] = make(rollupSet)
+				}
+				devices[s.id].add(level.Interval, t, v)
+
+				var stname string = newStName(s.id, p.Label(s.date))
+				if _, ok := keys[stname]; !ok {
+					keys[stname] = make(map[string]struct{})
+				}
+				keys[stname][string(s.AsKey())] = struct{}{}
+			}
+
+			var batches []s2k.Batch
+			for id, set := range devices {
+				var rollups []Rollup = set.sorted()
+				e := checkPartition(p, level, rollups)
+				if nil != e {
+					return e
+				}
+				for i := range rollups {
+					var bucket string = newRollupName(level.Name, p.Label(rollups[i].Start), id)
+					_ = fastAdder(ctx, bucket) // missing bucket -> get will be rejected anyway
+					val, e := get(ctx, bucket, rollupKey(rollups[i].Start))
+					if errors.Is(e, sql.ErrNoRows) {
+						continue
+					}
+					if nil != e {
+						return e
+					}
+					if 0 == len(val) {
+						continue
+					}
+					stored, e := rollupDecode(rollups[i].Start, val)
+					if nil != e {
+						return e
+					}
+					rollups[i].Merge(stored)
+				}
+				batches = append(batches, rollups2batch(p, level, id, rollups)...)
+
+				// the index is missing until the first partition of the device is rolled up
+				var index string = newRollupsName(level.Name, id)
+				e = fastAdder(ctx, index)
+				if nil != e {
+					return e
+				}
+				rlabels, e := lstStrings(ctx, lst, index)
+				if nil != e {
+					return e
+				}
+				var checked map[string]struct{} = make(map[string]struct{})
+				for _, label := range rlabels {
+					checked[label] = struct{}{}
+				}
+				for _, r := range rollups {
+					var label string = p.Label(r.Start)
+					if _, ok := checked[label]; ok {
+						continue
+					}
+					checked[label] = struct{}{}
+					var stname string = newStName(id, label)
+					if coveredBy(ctx, lst, stname, keys[stname]) {
+						batches = append(batches, rolledUpBatch(level, id, label))
+					}
+				}
+			}
+			return setRollups(ctx, fastAdder, setter, batches)
+		}
+	}
+}
+
+// WithRollups writes samples using the raw BatchSet and then the rollup BatchSet.
+func WithRollups(raw BatchSet, rollup BatchSet) BatchSet {
+	return func(ctx context.Context, many s2k.Iter[TsSample]) error {
+		var samples []TsSample = many.ToArray()
+		e := raw(ctx, s2k.IterFromArray(samples))
+		if nil != e {
+			return e
+		}
+		return rollup(ctx, s2k.IterFromArray(samples))
+	}
+}
+
+// RollupJob recomputes the rollups of the raw partition(data_<label>_<id>) and overwrites them.
+type RollupJob func(ctx context.Context, id string, label string) error
+
+// NewRollupJob creates a job which rolls up partitions(e.g. labels got by Catalog.DatesOf).
+// The partition is marked as rolled up after its rollups are written.
+// The value must decode the time from the key(see SampleValueNew).
+// Intervals must not span partitions(e.g. 1d rollups of hour partitions).
+func NewRollupJob(lst s2k.Lst, get s2k.Get, fastAdder s2k.AddBucket, setter s2k.SetBatch) func(p Partitioner, level RollupLevel, value SampleValue) RollupJob {
+	return func(p Partitioner, level RollupLevel, value SampleValue) RollupJob {
+		return func(ctx context.Context, id string, label string) error {
+			e := level.validate()
+			if nil != e {
+				return e
+			}
+			start, _, e := p.Interval(label)
+			if nil != e {
+				return e
+			}
+			samples, e := readPartition(ctx, lst, get, id, start, label)
+			if nil != e {
+				return e
+			}
+			var set rollupSet = make(rollupSet)
+			for _, s := range samples {
+				t, v, e := value(s)
+				if nil != e {
+					return fmt.Errorf("Invalid sample(id: %s): %v", id, e)
+				}
+				set.add(level.Interval, t, v)
+			}
+			var rollups []Rollup = set.sorted()
+			e = checkPartition(p, level, rollups)
+			if nil != e {
+				return e
+			}
+			var batches []s2k.Batch = rollups2batch(p, level, id, rollups)
+			return setRollups(ctx, fastAdder, setter, append(batches, rolledUpBatch(level, id, label)))
+		}
+	}
+}
+
+// RollupRead gets rollups of [start, end) whose interval is the resolution(ordered by Start).
+// Each raw sample becomes a rollup if the resolution is not positive.
+type RollupRead func(ctx context.Context, id string, start, end time.Time, resolution time.Duration) ([]Rollup, error)
+
+// pickLevel gets the coarsest level which divides the resolution.
+func pickLevel(levels []RollupLevel, resolution time.Duration) (level RollupLevel, ok bool) {
+	if resolution <= 0 {
+		return level, false
+	}
+	for _, l := range levels {
+		if 0 < l.Interval && 0 == resolution%l.Interval && level.Interval < l.Interval {
+			level, ok = l, true
+		}
+	}
+	return
+}
+
+// NewRollupReader creates a reader which uses rollups of the coarsest level which divides the resolution.
+// Raw samples are used for partitions not rolled up(or if no level matches).
+// The start is truncated by the resolution: the first rollup covers its whole interval.
+// The value must decode the time from the key(see SampleValueNew).
+func NewRollupReader(lst s2k.Lst, get s2k.Get) func(p Partitioner, levels []RollupLevel, value SampleValue) RollupRead {
+	return func(p Partitioner, levels []RollupLevel, value SampleValue) RollupRead {
+		return func(ctx context.Context, id string, start, end time.Time, resolution time.Duration) ([]Rollup, error) {
+			if 0 < resolution {
+				start = start.UTC().Truncate(resolution) // same as the start of the rollups
+			}
+			labels, e := CatalogNew(lst).DatesOf(ctx, id)
+			if nil != e {
+				return nil, e
+			}
+			level, useRollup := pickLevel(levels, resolution)
+			var rolledUp map[string]struct{} = make(map[string]struct{})
+			if useRollup {
+				// the index is missing until the first rollup of the device is written
+				rlabels, e := lstStrings(ctx, lst, newRollupsName(level.Name, id))
+				if nil == e {
+					for _, label := range rlabels {
+						rolledUp[label] = struct{}{}
+					}
+				}
+			}
+
+			var set rollupSet = make(rollupSet)
+			var raw []Rollup
+			add := func(r Rollup) {
+				if r.Start.Before(start) || !r.Start.Before(end) {
+					return
+				}
+				if resolution <= 0 {
+					raw = append(raw, r)
+					return
+				}
+				var rstart time.Time = r.Start.UTC().Truncate(resolution)
+				found, ok := set[rstart.UnixNano()]
+				if !ok {
+					found = &Rollup{Start: rstart}
+					set[rstart.UnixNano()] = found
+				}
+				found.Merge(r)
+			}
+
+			for _, label := range labels {
+				pstart, pend, e := p.Interval(label)
+				if nil != e {
+					return nil, e
+				}
+				if !pstart.Before(end) || !start.Before(pend) {
+					continue
+				}
+				if _, ok := rolledUp[label]; ok {
+					rollups, e := readRollups(ctx, lst, get, newRollupName(level.Name, label, id), start, end)
+					if nil != e {
+						return nil, e
+					}
+					for _, r := range rollups {
+						add(r)
+					}
+					continue
+				}
+				samples, e := readPartition(ctx, lst, get, id, pstart, label)
+				if nil != e {
+					return nil, e
+				}
+				for _, s := range samples {
+					t, v, e := value(s)
+					if nil != e {
+						return nil, fmt.Errorf("Invalid sample(id: %s): %v", id, e)
+					}
+					var r Rollup = Rollup{Start: t}
+					r.Add(t, v)
+					add(r)
+				}
+			}
+
+			if resolution <= 0 {
+				sort.SliceStable(raw, func(i, j int) bool { return raw[i].Start.Before(raw[j].Start) })
+				return raw, nil
+			}
+			return set.sorted(), nil
+		}
+	}
+}
+
+// readRollups gets rollups whose start is in [start, end).
+func readRollups(ctx context.Context, lst s2k.Lst, get s2k.Get, bucket string, start, end time.Time) ([]Rollup, error) {
+	keys, e := lstRange(ctx, lst, bucket, rollupKey(start), rollupKey(end))
+	if nil != e {
+		return nil, e
+	}
+	rollups := make([]Rollup, 0, len(keys))
+	for _, key := range keys {
+		rstart, e := rollupKeyDecode(key)
+		if nil != e {
+			return nil, e
+		}
+		val, e := get(ctx, bucket, key)
+		if nil != e {
+			return nil, e
+		}
+		r, e := rollupDecode(rstart, val)
+		if nil != e {
+			return nil, e
+		}
+		rollups = append(rollups, r)
+	}
+	return rollups, nil
+}
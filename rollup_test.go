@@ -0,0 +1,260 @@
+package stdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+func TestRollup(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 12, 0, 0, 0, time.UTC)
+	var value SampleValue = SampleValueNew(Float64Codec.Decode, rollupKeyDecode)
+	sample := func(id string, at time.Duration, v float64) TsSample {
+		val, _ := Float64Codec.Encode(v)
+		return TsSampleNew(id, dt.Add(at), rollupKey(dt.Add(at)), val)
+	}
+	samples := []TsSample{
+		sample("i3776", 10*time.Minute, 3.0),
+		sample("i3776", 20*time.Minute, 1.0),
+		sample("i3776", 70*time.Minute, 4.0),
+		sample("i3776", 30*time.Minute, 2.0),
+		sample("i634", 5*time.Minute, 9.0),
+		sample("i3776", 25*time.Hour, 5.0), // next partition
+	}
+
+	setup := func(t *testing.T, rollup bool) *memKv {
+		t.Helper()
+		kv := memKvNew()
+		var bset BatchSet = NewBatchSetter(kv.AddBucket, kv.SetBatch, 64)(DayPartitioner.Label)
+		if rollup {
+			var rset BatchSet = NewRollupWriter(kv.AddBucket, kv.Lst, kv.Get, kv.SetBatch)(DayPartitioner, Rollup1h, value)
+			bset = WithRollups(bset, rset)
+		}
+		// written in 2 batches to merge rollups
+		for _, batch := range [][]TsSample{samples[:2], samples[2:]} {
+			e := bset(context.Background(), s2k.IterFromArray(batch))
+			if nil != e {
+				t.Fatalf("Unable to set: %v", e)
+			}
+		}
+		return kv
+	}
+
+	t.Run("Rollup", func(t *testing.T) {
+		t.Parallel()
+
+		var r Rollup
+		r.Merge(Rollup{})
+		checker(uint64(0), r.Count, t)
+
+		r.Add(dt.Add(time.Second), 2.0)
+		r.Add(dt, 4.0) // older
+		r.Add(dt.Add(time.Second), -1.0)
+		checker(uint64(3), r.Count, t)
+		checker(-1.0, r.Min, t)
+		checker(4.0, r.Max, t)
+		checker(5.0, r.Sum, t)
+		checker(-1.0, r.Last, t)
+
+		decoded, e := rollupDecode(dt, r.encode())
+		if nil != e {
+			t.Fatalf("Unable to decode: %v", e)
+		}
+		checker(r.LastAt.Equal(decoded.LastAt), true, t)
+		decoded.LastAt = r.LastAt
+		decoded.Start = r.Start
+		checker(r, decoded, t)
+
+		_, e = rollupDecode(dt, nil)
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+	})
+
+	t.Run("writer", func(t *testing.T) {
+		t.Parallel()
+
+		kv := setup(t, true)
+		rollups, e := readRollups(context.Background(), kv.Lst, kv.Get, "rollup_1h_20220826_i3776", dt, dt.Add(24*time.Hour))
+		if nil != e {
+			t.Fatalf("Unable to read rollups: %v", e)
+		}
+		checker(2, len(rollups), t)
+		checker(uint64(3), rollups[0].Count, t)
+		checker(1.0, rollups[0].Min, t)
+		checker(3.0, rollups[0].Max, t)
+		checker(2.0, rollups[0].Mean(), t)
+		checker(2.0, rollups[0].Last, t) // 12:30
+		checker(dt.Add(time.Hour), rollups[1].Start, t)
+
+		labels, _ := lstStrings(context.Background(), kv.Lst, "rollups_1h_i3776")
+		checker(2, len(labels), t)
+	})
+
+	t.Run("reader", func(t *testing.T) {
+		t.Parallel()
+
+		var rollup *memKv = setup(t, true)
+		var raw *memKv = setup(t, false)
+		var levels []RollupLevel = []RollupLevel{Rollup1m, Rollup1h}
+		read := func(kv *memKv, resolution time.Duration) []Rollup {
+			t.Helper()
+			rollups, e := NewRollupReader(kv.Lst, kv.Get)(DayPartitioner, levels, value)(
+				context.Background(), "i3776", dt, dt.Add(48*time.Hour), resolution,
+			)
+			if nil != e {
+				t.Fatalf("Unable to read: %v", e)
+			}
+			return rollups
+		}
+
+		for _, resolution := range []time.Duration{time.Hour, 2 * time.Hour, 24 * time.Hour, 90 * time.Minute} {
+			got := read(rollup, resolution)
+			expected := read(raw, resolution)
+			checker(len(expected), len(got), t)
+			for i := range got {
+				checker(expected[i].Start, got[i].Start, t)
+				checker(expected[i].Count, got[i].Count, t)
+				checker(expected[i].Sum, got[i].Sum, t)
+				checker(expected[i].Last, got[i].Last, t)
+			}
+		}
+
+		// the start is aligned to the resolution on both paths
+		for _, kv := range []*memKv{rollup, raw} {
+			got, e := NewRollupReader(kv.Lst, kv.Get)(DayPartitioner, levels, value)(
+				context.Background(), "i3776", dt.Add(30*time.Minute), dt.Add(48*time.Hour), time.Hour,
+			)
+			if nil != e {
+				t.Fatalf("Unable to read: %v", e)
+			}
+			checker(dt, got[0].Start, t)
+			checker(uint64(3), got[0].Count, t)
+		}
+
+		got := read(rollup, 24*time.Hour)
+		checker(2, len(got), t)
+		checker(uint64(4), got[0].Count, t)
+		checker(4.0, got[0].Last, t) // 13:10
+
+		got = read(rollup, 0)
+		checker(5, len(got), t)
+		checker(3.0, got[0].Sum, t)
+		checker(dt.Add(30*time.Minute), got[2].Start, t)
+
+		// rollups are used instead of raw samples
+		rollup.lk.Lock()
+		rollup.buckets["data_20220826_i3776"] = make(map[string][]byte)
+		rollup.lk.Unlock()
+		got = read(rollup, time.Hour)
+		checker(3, len(got), t)
+		checker(uint64(3), got[0].Count, t)
+		checker(1, len(read(rollup, 0)), t) // raw samples of the next partition only
+		checker(Rollup1h, func() RollupLevel { l, _ := pickLevel(levels, 3*time.Hour); return l }(), t)
+		_, ok := pickLevel(levels, 90*time.Second)
+		checker(false, ok, t)
+	})
+
+	t.Run("enabled on a live system", func(t *testing.T) {
+		t.Parallel()
+
+		kv := memKvNew()
+		var raw BatchSet = NewBatchSetter(kv.AddBucket, kv.SetBatch, 64)(DayPartitioner.Label)
+		var rset BatchSet = NewRollupWriter(kv.AddBucket, kv.Lst, kv.Get, kv.SetBatch)(DayPartitioner, Rollup1h, value)
+		for i, bset := range []BatchSet{raw, WithRollups(raw, rset)} {
+			e := bset(context.Background(), s2k.IterFromArray([][]TsSample{samples[:2], samples[2:]}[i]))
+			if nil != e {
+				t.Fatalf("Unable to set: %v", e)
+			}
+		}
+		read := func() []Rollup {
+			t.Helper()
+			rollups, e := NewRollupReader(kv.Lst, kv.Get)(DayPartitioner, []RollupLevel{Rollup1h}, value)(
+				context.Background(), "i3776", dt, dt.Add(48*time.Hour), time.Hour,
+			)
+			if nil != e {
+				t.Fatalf("Unable to read: %v", e)
+			}
+			return rollups
+		}
+
+		// samples written before the rollups are enabled are read from raw samples
+		labels, _ := lstStrings(context.Background(), kv.Lst, "rollups_1h_i3776")
+		checker(1, len(labels), t)
+		checker("20220827", labels[0], t)
+		got := read()
+		checker(3, len(got), t)
+		checker(uint64(3), got[0].Count, t)
+
+		e := NewRollupJob(kv.Lst, kv.Get, kv.AddBucket, kv.SetBatch)(DayPartitioner, Rollup1h, value)(
+			context.Background(), "i3776", "20220826",
+		)
+		if nil != e {
+			t.Fatalf("Unable to run the job: %v", e)
+		}
+		labels, _ = lstStrings(context.Background(), kv.Lst, "rollups_1h_i3776")
+		checker(2, len(labels), t)
+		got = read()
+		checker(3, len(got), t)
+		checker(uint64(3), got[0].Count, t)
+	})
+
+	t.Run("writer index error", func(t *testing.T) {
+		t.Parallel()
+
+		kv := memKvNew()
+		var lst s2k.Lst = func(ctx context.Context, bucket string, cb func(key []byte) error) error {
+			if "rollups_1h_i3776" == bucket {
+				return fmt.Errorf("Must fail")
+			}
+			return kv.Lst(ctx, bucket, cb)
+		}
+		e := NewRollupWriter(kv.AddBucket, lst, kv.Get, kv.SetBatch)(DayPartitioner, Rollup1h, value)(
+			context.Background(), s2k.IterFromArray(samples[:1]),
+		)
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+	})
+
+	t.Run("job", func(t *testing.T) {
+		t.Parallel()
+
+		kv := setup(t, true)
+		// counted twice
+		e := NewRollupWriter(kv.AddBucket, kv.Lst, kv.Get, kv.SetBatch)(DayPartitioner, Rollup1h, value)(
+			context.Background(), s2k.IterFromArray(samples[:1]),
+		)
+		if nil != e {
+			t.Fatalf("Unable to set: %v", e)
+		}
+
+		var job RollupJob = NewRollupJob(kv.Lst, kv.Get, kv.AddBucket, kv.SetBatch)(DayPartitioner, Rollup1h, value)
+		e = job(context.Background(), "i3776", "20220826")
+		if nil != e {
+			t.Fatalf("Unable to run the job: %v", e)
+		}
+		rollups, _ := readRollups(context.Background(), kv.Lst, kv.Get, "rollup_1h_20220826_i3776", dt, dt.Add(time.Hour))
+		checker(1, len(rollups), t)
+		checker(uint64(3), rollups[0].Count, t)
+
+		// 1d rollups span hour partitions
+		e = checkPartition(HourPartitioner, Rollup1d, []Rollup{{Start: dt.Truncate(24 * time.Hour)}})
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+		checker(nil, checkPartition(DayPartitioner, Rollup1d, []Rollup{{Start: dt.Truncate(24 * time.Hour)}}), t)
+
+		e = NewRollupJob(kv.Lst, kv.Get, kv.AddBucket, kv.SetBatch)(DayPartitioner, RollupLevel{Name: "1H", Interval: time.Hour}, value)(
+			context.Background(), "i3776", "20220826",
+		)
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+	})
+}
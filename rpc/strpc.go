@@ -0,0 +1,367 @@
+// Package strpc provides the gRPC service defined in stdb.proto and its client.
+//
+// Messages are encoded using protowire(no generated code);
+// the wire format is compatible with clients generated from stdb.proto.
+package strpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/mem"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	"github.com/takanoriyanagitani/go-spacetimedb/internal/pbwire"
+	vlpb "github.com/takanoriyanagitani/go-spacetimedb/vlog/pb"
+)
+
+const (
+	ServiceName = "spacetimedb.rpc.v1.Stdb"
+
+	methodWrite = "/" + ServiceName + "/Write"
+	methodRead  = "/" + ServiceName + "/Read"
+
+	defaultBatchSize int = 1024
+)
+
+// field numbers(see stdb.proto)
+const (
+	fieldAccepted protowire.Number = 1
+
+	fieldReqId    protowire.Number = 1
+	fieldReqStart protowire.Number = 2
+	fieldReqEnd   protowire.Number = 3
+)
+
+type message interface {
+	AppendMessage(b []byte) []byte
+	UnmarshalMessage(b []byte) error
+}
+
+// Sample is the spacetimedb.vlog.v1.Sample message.
+type Sample struct{ vlpb.SampleDto }
+
+func (s *Sample) UnmarshalMessage(b []byte) (e error) {
+	s.SampleDto, e = vlpb.FromMessage(b)
+	return
+}
+
+type WriteResult struct {
+	Accepted uint64
+}
+
+func (w *WriteResult) AppendMessage(b []byte) []byte {
+	if 0 == w.Accepted {
+		return b
+	}
+	b = protowire.AppendTag(b, fieldAccepted, protowire.VarintType)
+	return protowire.AppendVarint(b, w.Accepted)
+}
+
+func (w *WriteResult) UnmarshalMessage(b []byte) error {
+	return pbwire.ConsumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if fieldAccepted == num && protowire.VarintType == typ {
+			v, n := protowire.ConsumeVarint(b)
+			w.Accepted = v
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
+
+type ReadRequest struct {
+	Id    string
+	Start time.Time
+	End   time.Time
+}
+
+func (r *ReadRequest) AppendMessage(b []byte) []byte {
+	if 0 < len(r.Id) {
+		b = protowire.AppendTag(b, fieldReqId, protowire.BytesType)
+		b = protowire.AppendString(b, r.Id)
+	}
+	b = protowire.AppendTag(b, fieldReqStart, protowire.BytesType)
+	b = protowire.AppendBytes(b, vlpb.AppendTimestamp(nil, r.Start))
+	b = protowire.AppendTag(b, fieldReqEnd, protowire.BytesType)
+	return protowire.AppendBytes(b, vlpb.AppendTimestamp(nil, r.End))
+}
+
+func (r *ReadRequest) UnmarshalMessage(b []byte) error {
+	r.Start = time.Unix(0, 0).UTC()
+	r.End = r.Start
+	return pbwire.ConsumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if protowire.BytesType != typ {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, nil
+		}
+		var e error
+		switch num {
+		case fieldReqId:
+			r.Id = string(v)
+		case fieldReqStart:
+			r.Start, e = vlpb.ConsumeTimestamp(v)
+		case fieldReqEnd:
+			r.End, e = vlpb.ConsumeTimestamp(v)
+		}
+		return n, e
+	})
+}
+
+// codec encodes the messages of the service;
+// other messages(e.g. health checks registered on the same server) are encoded by the proto codec.
+type codec struct{}
+
+func (c codec) Marshal(v any) (mem.BufferSlice, error) {
+	m, ok := v.(message)
+	if !ok {
+		return encoding.GetCodecV2(c.Name()).Marshal(v)
+	}
+	return mem.BufferSlice{mem.SliceBuffer(m.AppendMessage(nil))}, nil
+}
+
+func (c codec) Unmarshal(data mem.BufferSlice, v any) error {
+	m, ok := v.(message)
+	if !ok {
+		return encoding.GetCodecV2(c.Name()).Unmarshal(data, v)
+	}
+	return m.UnmarshalMessage(data.Materialize())
+}
+
+// Name is the content subtype(application/grpc+proto).
+func (c codec) Name() string { return "proto" }
+
+// Server is the handler type of the service.
+type Server interface {
+	Write(stream grpc.ServerStream) error
+	Read(req *ReadRequest, stream grpc.ServerStream) error
+}
+
+var ServiceDesc grpc.ServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Server)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Write",
+			Handler:       func(srv any, stream grpc.ServerStream) error { return srv.(Server).Write(stream) },
+			ClientStreams: true,
+		},
+		{
+			StreamName: "Read",
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				var req ReadRequest
+				e := stream.RecvMsg(&req)
+				if nil != e {
+					return e
+				}
+				return srv.(Server).Read(&req, stream)
+			},
+			ServerStreams: true,
+		},
+	},
+	Metadata: "stdb.proto",
+}
+
+// ServerCodec must be used by servers which register the service.
+// Other services on the server use the proto codec.
+func ServerCodec() grpc.ServerOption { return grpc.ForceServerCodecV2(codec{}) }
+
+type server struct {
+	bset      sp.BatchSet
+	read      sp.RangeRead
+	batchSize int
+	validate  sp.IdValidator
+}
+
+type ServerOption func(s *server)
+
+// BatchSize sets the max number of samples written by a BatchSet call(default: 1024).
+// The limit of the batch setter must be sp.BatchesPerSample times the size or more.
+func BatchSize(n int) ServerOption {
+	return func(s *server) {
+		if 0 < n {
+			s.batchSize = n
+		}
+	}
+}
+
+// IdValidator rejects samples which can not be stored(default: sp.DefaultIdValidator).
+func IdValidator(v sp.IdValidator) ServerOption {
+	return func(s *server) { s.validate = v }
+}
+
+func ServerNew(bset sp.BatchSet, read sp.RangeRead, opts ...ServerOption) Server {
+	s := &server{bset: bset, read: read, batchSize: defaultBatchSize, validate: sp.DefaultIdValidator}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register registers the server. The server must be created with ServerCodec.
+func Register(g *grpc.Server, s Server) { g.RegisterService(&ServiceDesc, s) }
+
+func (s *server) flush(ctx context.Context, samples []sp.TsSample) error {
+	if 0 == len(samples) {
+		return nil
+	}
+	e := s.bset(ctx, s2k.IterFromArray(samples))
+	if nil != e {
+		return status.Errorf(codes.Internal, "Unable to write: %v", e)
+	}
+	return nil
+}
+
+// noDate checks the date of a sample(vlpb.FromMessage uses the unix epoch for missing dates).
+func noDate(date time.Time) bool { return date.IsZero() || 0 == date.UnixNano() }
+
+func (s *server) Write(stream grpc.ServerStream) error {
+	var ctx context.Context = stream.Context()
+	var accepted uint64 = 0
+	var samples []sp.TsSample
+	for {
+		var sample Sample
+		e := stream.RecvMsg(&sample)
+		if io.EOF == e {
+			break
+		}
+		if nil != e {
+			return e
+		}
+		e = s.validate(sample.Id)
+		if nil == e && noDate(sample.Date) {
+			e = fmt.Errorf("No date: %q", sample.Id)
+		}
+		if nil != e {
+			// samples of flushed batches are already written
+			return status.Errorf(codes.InvalidArgument, "Invalid sample(#%d): %v", accepted+uint64(len(samples)), e)
+		}
+		samples = append(samples, sample.ToSample())
+		if len(samples) < s.batchSize {
+			continue
+		}
+		e = s.flush(ctx, samples)
+		if nil != e {
+			return e
+		}
+		accepted += uint64(len(samples))
+		samples = nil
+	}
+	e := s.flush(ctx, samples)
+	if nil != e {
+		return e
+	}
+	accepted += uint64(len(samples))
+	return stream.SendMsg(&WriteResult{Accepted: accepted})
+}
+
+func (s *server) Read(req *ReadRequest, stream grpc.ServerStream) error {
+	many, e := s.read(stream.Context(), req.Id, req.Start, req.End)
+	if nil != e {
+		return status.Errorf(codes.Internal, "Unable to read: %v", e)
+	}
+	for o := many(); o.HasValue(); o = many() {
+		var sample Sample
+		o.Value().ForUser(&sample)
+		e = stream.SendMsg(&sample)
+		if nil != e {
+			return e
+		}
+	}
+	return nil
+}
+
+// Client calls the service.
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+func ClientNew(conn grpc.ClientConnInterface) *Client { return &Client{conn: conn} }
+
+// Write sends all samples and returns the number of samples written.
+func (c *Client) Write(ctx context.Context, many s2k.Iter[sp.TsSample]) (accepted uint64, e error) {
+	stream, e := c.conn.NewStream(ctx, &ServiceDesc.Streams[0], methodWrite, grpc.ForceCodecV2(codec{}))
+	if nil != e {
+		return 0, e
+	}
+	for o := many(); o.HasValue(); o = many() {
+		var sample Sample
+		o.Value().ForUser(&sample)
+		e = stream.SendMsg(&sample)
+		if io.EOF == e {
+			break // the error will be got by RecvMsg
+		}
+		if nil != e {
+			return 0, e
+		}
+	}
+	e = stream.CloseSend()
+	if nil != e {
+		return 0, e
+	}
+	var result WriteResult
+	e = stream.RecvMsg(&result)
+	return result.Accepted, e
+}
+
+func (c *Client) AsBatchSet() sp.BatchSet {
+	return func(ctx context.Context, many s2k.Iter[sp.TsSample]) error {
+		_, e := c.Write(ctx, many)
+		return e
+	}
+}
+
+// ReadEach calls the consumer for each sample in the partitions which overlap [start, end).
+func (c *Client) ReadEach(ctx context.Context, id string, start, end time.Time, consumer func(sp.TsSample) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, e := c.conn.NewStream(ctx, &ServiceDesc.Streams[1], methodRead, grpc.ForceCodecV2(codec{}))
+	if nil != e {
+		return e
+	}
+	e = stream.SendMsg(&ReadRequest{Id: id, Start: start, End: end})
+	if nil != e {
+		return e
+	}
+	e = stream.CloseSend()
+	if nil != e {
+		return e
+	}
+	for {
+		var sample Sample
+		e = stream.RecvMsg(&sample)
+		if io.EOF == e {
+			return nil
+		}
+		if nil != e {
+			return e
+		}
+		e = consumer(sample.ToSample())
+		if nil != e {
+			return e
+		}
+	}
+}
+
+func (c *Client) AsRangeRead() sp.RangeRead {
+	return func(ctx context.Context, id string, start, end time.Time) (s2k.Iter[sp.TsSample], error) {
+		var samples []sp.TsSample
+		e := c.ReadEach(ctx, id, start, end, func(s sp.TsSample) error {
+			samples = append(samples, s)
+			return nil
+		})
+		return s2k.IterFromArray(samples), e
+	}
+}
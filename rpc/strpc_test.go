@@ -0,0 +1,233 @@
+package strpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	vlpb "github.com/takanoriyanagitani/go-spacetimedb/vlog/pb"
+)
+
+func checker[T comparable](t *testing.T, got T, expected T) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("Unexpected value got.\n")
+		t.Errorf("expected: %v\n", expected)
+		t.Errorf("got:      %v\n", got)
+	}
+}
+
+// memStore keeps samples of a device sorted by (date, key).
+type memStore struct {
+	lk      sync.Mutex
+	samples []sp.TsSample
+	calls   int
+}
+
+func (m *memStore) BatchSet(_ context.Context, many s2k.Iter[sp.TsSample]) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.calls += 1
+	m.samples = append(m.samples, many.ToArray()...)
+	return nil
+}
+
+func (m *memStore) RangeRead(_ context.Context, id string, start, end time.Time) (s2k.Iter[sp.TsSample], error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	var found []sp.TsSample
+	for _, s := range m.samples {
+		var dto vlpb.SampleDto
+		s.ForUser(&dto)
+		if id == dto.Id && !dto.Date.Before(start) && dto.Date.Before(end) {
+			found = append(found, s)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		var a, b vlpb.SampleDto
+		found[i].ForUser(&a)
+		found[j].ForUser(&b)
+		return a.Date.Before(b.Date)
+	})
+	return s2k.IterFromArray(found), nil
+}
+
+func dial(t *testing.T, srv Server) *Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	g := grpc.NewServer(ServerCodec())
+	Register(g, srv)
+	healthpb.RegisterHealthServer(g, health.NewServer()) // other services use the proto codec
+	go func() { _ = g.Serve(lis) }()
+	t.Cleanup(g.Stop)
+
+	conn, e := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if nil != e {
+		t.Fatalf("Unable to connect: %v", e)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return ClientNew(conn)
+}
+
+func TestRpc(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 123456789, time.UTC)
+
+	t.Run("write and read", func(t *testing.T) {
+		t.Parallel()
+
+		var m memStore
+		var c *Client = dial(t, ServerNew(m.BatchSet, m.RangeRead, BatchSize(2)))
+
+		var samples []sp.TsSample
+		for i := 0; i < 5; i++ {
+			samples = append(samples, sp.TsSampleNew(
+				"cafef00d",
+				dt.Add(time.Duration(i)*time.Hour),
+				[]byte(fmt.Sprintf("k%d", i)),
+				[]byte(fmt.Sprintf("v%d", i)),
+			))
+		}
+		samples = append(samples, sp.TsSampleNew("deadbeaf", dt, []byte("k"), []byte("v")))
+
+		accepted, e := c.Write(context.Background(), s2k.IterFromArray(samples))
+		if nil != e {
+			t.Fatalf("Unable to write: %v", e)
+		}
+		checker(t, accepted, 6)
+		checker(t, m.calls, 3)
+
+		many, e := c.AsRangeRead()(context.Background(), "cafef00d", dt.Add(time.Hour), dt.Add(4*time.Hour))
+		if nil != e {
+			t.Fatalf("Unable to read: %v", e)
+		}
+		var got []sp.TsSample = many.ToArray()
+		checker(t, len(got), 3)
+
+		var dto vlpb.SampleDto
+		got[0].ForUser(&dto)
+		checker(t, string(dto.Val), "v1")
+		checker(t, dto.Date.Equal(dt.Add(time.Hour)), true)
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		t.Parallel()
+
+		var m memStore
+		var c *Client = dial(t, ServerNew(func(_ context.Context, _ s2k.Iter[sp.TsSample]) error {
+			return fmt.Errorf("Must fail")
+		}, m.RangeRead))
+
+		e := c.AsBatchSet()(context.Background(), s2k.IterFromArray([]sp.TsSample{
+			sp.TsSampleNew("cafef00d", dt, nil, nil),
+		}))
+		checker(t, status.Code(e), codes.Internal)
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		t.Parallel()
+
+		var m memStore
+		var c *Client = dial(t, ServerNew(m.BatchSet, m.RangeRead))
+		_, e := c.Write(context.Background(), s2k.IterFromArray([]sp.TsSample{
+			sp.TsSampleNew("cafef00d", dt, []byte("k0"), nil),
+			sp.TsSampleNew("DROP TABLE", dt, []byte("k1"), nil),
+		}))
+		checker(t, status.Code(e), codes.InvalidArgument)
+		checker(t, len(m.samples), 0)
+
+		c = dial(t, ServerNew(m.BatchSet, m.RangeRead, IdValidator(func(_ string) error { return nil })))
+		accepted, e := c.Write(context.Background(), s2k.IterFromArray([]sp.TsSample{
+			sp.TsSampleNew("DROP TABLE", dt, []byte("k1"), nil),
+		}))
+		if nil != e {
+			t.Fatalf("Unable to write: %v", e)
+		}
+		checker(t, accepted, 1)
+
+		for _, date := range []time.Time{{}, time.Unix(0, 0)} {
+			_, e = c.Write(context.Background(), s2k.IterFromArray([]sp.TsSample{
+				sp.TsSampleNew("cafef00d", date, []byte("k0"), nil),
+			}))
+			checker(t, status.Code(e), codes.InvalidArgument)
+		}
+	})
+
+	t.Run("health", func(t *testing.T) {
+		t.Parallel()
+
+		var m memStore
+		var c *Client = dial(t, ServerNew(m.BatchSet, m.RangeRead))
+		res, e := healthpb.NewHealthClient(c.conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		if nil != e {
+			t.Fatalf("Unable to check: %v", e)
+		}
+		checker(t, res.GetStatus(), healthpb.HealthCheckResponse_SERVING)
+	})
+
+	t.Run("read stop", func(t *testing.T) {
+		t.Parallel()
+
+		var m memStore
+		var c *Client = dial(t, ServerNew(m.BatchSet, m.RangeRead))
+		_, e := c.Write(context.Background(), s2k.IterFromArray([]sp.TsSample{
+			sp.TsSampleNew("cafef00d", dt, []byte("k0"), nil),
+			sp.TsSampleNew("cafef00d", dt, []byte("k1"), nil),
+		}))
+		if nil != e {
+			t.Fatalf("Unable to write: %v", e)
+		}
+
+		var stop error = fmt.Errorf("stop")
+		var n int = 0
+		e = c.ReadEach(context.Background(), "cafef00d", dt, dt.Add(time.Hour), func(_ sp.TsSample) error {
+			n += 1
+			return stop
+		})
+		checker(t, e, stop)
+		checker(t, n, 1)
+	})
+}
+
+func TestReadRequest(t *testing.T) {
+	t.Parallel()
+
+	req := ReadRequest{
+		Id:    "cafef00d",
+		Start: time.Date(2022, time.August, 26, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2022, time.August, 27, 0, 0, 0, 1, time.UTC),
+	}
+	var decoded ReadRequest
+	e := decoded.UnmarshalMessage(req.AppendMessage(nil))
+	if nil != e {
+		t.Fatalf("Unable to decode: %v", e)
+	}
+	checker(t, decoded.Id, req.Id)
+	checker(t, decoded.Start.Equal(req.Start), true)
+	checker(t, decoded.End.Equal(req.End), true)
+
+	e = decoded.UnmarshalMessage([]byte{0x12, 0x05})
+	if nil == e {
+		t.Errorf("Must fail")
+	}
+}
@@ -2,8 +2,9 @@ package stdb
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
-	"sync"
 	"time"
 
 	s2k "github.com/takanoriyanagitani/go-sql2keyval"
@@ -25,7 +26,7 @@ type TsUser interface {
 }
 
 func TsSampleNew(id string, date time.Time, Key, Val []byte) TsSample {
-	pair := s2k.Pair{Key, Val}
+	pair := s2k.Pair{Key: Key, Val: Val}
 	return TsSample{
 		id,
 		date,
@@ -45,18 +46,28 @@ func (t TsSample) ForUser(u TsUser) {
 	u.UseVal(t.pair.Val)
 }
 
-func (t TsSample) ToBatch(d2s Date2Str) s2k.Iter[s2k.Batch] {
+func (t TsSample) toIndexBatch(ymd string) []s2k.Batch { return t.toNamedIndexBatch(ymd, "") }
+
+// toNamedIndexBatch records the partitioner name as the value of dates_<id>.
+func (t TsSample) toNamedIndexBatch(ymd string, name string) []s2k.Batch {
 	bid := []byte(t.id)
-	ymd := d2s(t.date)
 	bym := []byte(ymd)
 	emp := []byte("")
-	return s2k.IterFromArray([]s2k.Batch{
+	return []s2k.Batch{
 		s2k.BatchNew("devices", bid, emp),
 		s2k.BatchNew("dates", bym, emp),
-		s2k.BatchNew(t.ToDatesTableName(), bym, emp),
+		s2k.BatchNew(t.ToDatesTableName(), bym, []byte(name)),
 		s2k.BatchNew(t.ToDevicesTableName(ymd), bid, emp),
-		s2k.BatchNew(t.ToDtDvTableName(ymd), t.AsKey(), t.AsVal()),
-	})
+	}
+}
+
+func (t TsSample) toDataBatch(ymd string) s2k.Batch {
+	return s2k.BatchNew(t.ToDtDvTableName(ymd), t.AsKey(), t.AsVal())
+}
+
+func (t TsSample) ToBatch(d2s Date2Str) s2k.Iter[s2k.Batch] {
+	ymd := d2s(t.date)
+	return s2k.IterFromArray(append(t.toIndexBatch(ymd), t.toDataBatch(ymd)))
 }
 
 type BatchSet func(ctx context.Context, b s2k.Iter[TsSample]) error
@@ -111,52 +122,80 @@ func NewSetter(adder s2k.AddBucket, setter s2k.Set) func(dateConverter Date2Str,
 	}
 }
 
+// FastBucketAdderNew creates an adder which remembers all created buckets.
+// Use BucketCache to limit the size or to forget dropped buckets.
 func FastBucketAdderNew(adder s2k.AddBucket) s2k.AddBucket {
-	mp := make(map[string]interface{})
-	var lk sync.RWMutex
-
-	hasBucket := func(b string) bool {
-		lk.RLock()
-		_, ok := mp[b]
-		lk.RUnlock()
-		return ok
-	}
+	return BucketCacheNew().AsAdder(adder)
+}
 
-	addBucket := func(ctx context.Context, b string) error {
-		e := adder(ctx, b)
-		if nil != e {
-			return e
+// BatchesPerSample is the max number of batches needed by a sample(4 index entries + data).
+// A setter created with the limit BatchesPerSample*n accepts n samples per call.
+const BatchesPerSample int = 5
+
+// ErrBatchLimit is returned when samples need more batches than the limit of the setter.
+// Nothing is written: split the samples into smaller batches(see ChunkedBatchSet).
+var ErrBatchLimit = errors.New("Too many batches")
+
+// samples2batch converts samples into at most lmt batches.
+// Identical index entries are written only once.
+func samples2batch(s s2k.Iter[TsSample], d2s Date2Str, lmt int, dedup *batchDedup) (s2k.Iter[s2k.Batch], error) {
+	var batches []s2k.Batch
+	for o := s(); o.HasValue(); o = s() {
+		batches = dedup.append(batches, o.Value(), d2s)
+		if lmt < len(batches) {
+			return nil, fmt.Errorf("%w(limit=%v)", ErrBatchLimit, lmt)
 		}
-		lk.Lock()
-		defer lk.Unlock()
-		mp[b] = nil
-		return e
 	}
+	return s2k.IterFromArray(batches), nil
+}
 
-	return func(ctx context.Context, bucket string) error {
-		if hasBucket(bucket) {
+// ChunkedBatchSet writes samples using the batch setter at most size samples per call.
+// Chunks written before an error are kept.
+func ChunkedBatchSet(bset BatchSet, size int) BatchSet {
+	size = max(size, 1)
+	return func(ctx context.Context, many s2k.Iter[TsSample]) error {
+		var chunk []TsSample
+		for o := many(); o.HasValue(); o = many() {
+			chunk = append(chunk, o.Value())
+			if len(chunk) < size {
+				continue
+			}
+			e := bset(ctx, s2k.IterFromArray(chunk))
+			if nil != e {
+				return e
+			}
+			chunk = nil
+		}
+		if 0 == len(chunk) {
 			return nil
 		}
-		return addBucket(ctx, bucket)
+		return bset(ctx, s2k.IterFromArray(chunk))
 	}
 }
 
-func samples2batch(s s2k.Iter[TsSample], d2s Date2Str, lmt int) s2k.Iter[s2k.Batch] {
-	mapd := s2k.IterMap(s, func(ts TsSample) s2k.Iter[s2k.Batch] { return ts.ToBatch(d2s) })
-	c := make(chan s2k.Batch, lmt)
-	s2k.IterFlat2Chan(mapd, c, lmt)
-	close(c)
-	return s2k.IterFromChan(c)
+func NewBatchSetter(fastAdder s2k.AddBucket, setter s2k.SetBatch, lmt int) func(dateConverter Date2Str) BatchSet {
+	return NewCachedBatchSetter(fastAdder, setter, lmt, nil)
 }
 
-func NewBatchSetter(fastAdder s2k.AddBucket, setter s2k.SetBatch, lmt int) func(dateConverter Date2Str) BatchSet {
+// NewCachedBatchSetter creates a batch setter which skips index entries found in the cache.
+// The cache is shared across batches and updated only after successful writes.
+func NewCachedBatchSetter(fastAdder s2k.AddBucket, setter s2k.SetBatch, lmt int, cache *IndexCache) func(dateConverter Date2Str) BatchSet {
 	return func(dateConverter Date2Str) BatchSet {
 		return func(ctx context.Context, many s2k.Iter[TsSample]) error {
-			var bi s2k.Iter[s2k.Batch] = samples2batch(many, dateConverter, lmt)
+			var dedup *batchDedup = batchDedupNew(cache)
+			bi, e := samples2batch(many, dateConverter, lmt, dedup)
+			if nil != e {
+				return e
+			}
 			var createOrIgnore = bi.IntoInspect(func(b s2k.Batch) {
 				_ = fastAdder(ctx, b.Bucket()) // unable to create missing table -> query will be rejected anyway
 			})
-			return setter(ctx, createOrIgnore)
+			e = setter(ctx, createOrIgnore)
+			if nil != e {
+				return e
+			}
+			dedup.commit()
+			return nil
 		}
 	}
 }
@@ -97,5 +97,77 @@ func BenchmarkStdb(b *testing.B) {
 
 	})
 
+	b.Run("pgx partitioned benchmark", func(b *testing.B) {
+		var d2s Date2Str = func(_ time.Time) string { return "2022_09_01" }
+		var day time.Time = time.Date(2022, time.September, 1, 0, 0, 0, 0, time.UTC)
+
+		var tableDropper s2k.DelBucket = spx.PgxDelBucketNew(pool)
+		var tableCreater s2k.AddBucket = spx.PgxAddBucketNew(pool)
+		var upsert s2k.SetBatch = spx.PgxBatchUpsertNew(pool)
+		var fastCreator s2k.AddBucket = FastBucketAdderNew(tableCreater)
+
+		for _, tablename := range []string{"dates", "dates_idid", "devices", "devices_2022_09_01", "data_2022_09_01_idid"} {
+			e := tableDropper(context.Background(), tablename)
+			if nil != e {
+				b.Errorf("Unable to drop table: %v", e)
+			}
+		}
+
+		partitioned, e := PgPartitionedNew(pool, "bench_samples", DayPartitioner)
+		if nil != e {
+			b.Fatalf("Unable to create backend: %v", e)
+		}
+		e = partitioned.Drop(context.Background())
+		if nil != e {
+			b.Fatalf("Unable to drop: %v", e)
+		}
+		e = partitioned.Init(context.Background())
+		if nil != e {
+			b.Fatalf("Unable to init: %v", e)
+		}
+
+		backends := []struct {
+			name string
+			bset BatchSet
+		}{
+			{"table per bucket", NewBatchSetter(fastCreator, upsert, 1048576)(d2s)},
+			{"declarative partitioning", partitioned.AsBatchSet()},
+		}
+
+		randBytes := make([]byte, 8192)
+		_, e = rand.Read(randBytes)
+		if nil != e {
+			b.Errorf("Unable to init rand bytes: %v", e)
+		}
+
+		i2sample := func(_ int) TsSample {
+			keybuf := make([]byte, 8)
+			binary.BigEndian.PutUint64(keybuf, uint64(time.Now().UnixNano()))
+			return TsSampleNew("idid", day, keybuf, randBytes)
+		}
+
+		for _, backend := range backends {
+			backend := backend
+			b.Run(backend.name, func(b *testing.B) {
+				for _, itersz := range []int{16, 128} {
+					b.Run("iter sz: "+strconv.Itoa(itersz), func(b *testing.B) {
+						b.ResetTimer()
+						b.RunParallel(func(pb *testing.PB) {
+							for pb.Next() {
+								var integers s2k.Iter[int] = s2k.IterInts(0, itersz)
+								var samples s2k.Iter[TsSample] = s2k.IterMap(integers, i2sample)
+								e := backend.bset(context.Background(), samples)
+								if nil != e {
+									b.Errorf("Unable to upsert: %v", e)
+								}
+							}
+						})
+						b.ReportMetric(float64(b.N)*float64(itersz), "inserts")
+					})
+				}
+			})
+		}
+	})
+
 	b.Cleanup(func() { pool.Close() })
 }
@@ -0,0 +1,89 @@
+package stdb
+
+import (
+	"context"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+type TypedSample[K, V any] struct {
+	Id   string
+	Date time.Time
+	Key  K
+	Val  V
+}
+
+type TypedSet[K, V any] func(ctx context.Context, id string, date time.Time, key K, val V) error
+type TypedBatchSet[K, V any] func(ctx context.Context, many s2k.Iter[TypedSample[K, V]]) error
+type TypedGet[K, V any] func(ctx context.Context, id string, date time.Time) ([]TypedSample[K, V], error)
+
+func TypedSampleEncode[K, V any](s TypedSample[K, V], kc Codec[K], vc Codec[V]) (t TsSample, e error) {
+	key, e := kc.Encode(s.Key)
+	if nil != e {
+		return t, e
+	}
+	val, e := vc.Encode(s.Val)
+	if nil != e {
+		return t, e
+	}
+	return TsSampleNew(s.Id, s.Date, key, val), nil
+}
+
+func TypedSampleDecode[K, V any](t TsSample, kc Codec[K], vc Codec[V]) (s TypedSample[K, V], e error) {
+	s.Id = t.id
+	s.Date = t.date
+	s.Key, e = kc.Decode(t.AsKey())
+	if nil != e {
+		return
+	}
+	s.Val, e = vc.Decode(t.AsVal())
+	return
+}
+
+func TypedSetNew[K, V any](set Set, kc Codec[K], vc Codec[V]) TypedSet[K, V] {
+	return func(ctx context.Context, id string, date time.Time, key K, val V) error {
+		bkey, e := kc.Encode(key)
+		if nil != e {
+			return e
+		}
+		bval, e := vc.Encode(val)
+		if nil != e {
+			return e
+		}
+		return set(ctx, id, date, bkey, bval)
+	}
+}
+
+// TypedBatchSetNew creates a batch setter which encodes all samples before writing them.
+// Nothing will be written if any sample cannot be encoded.
+func TypedBatchSetNew[K, V any](bset BatchSet, kc Codec[K], vc Codec[V]) TypedBatchSet[K, V] {
+	return func(ctx context.Context, many s2k.Iter[TypedSample[K, V]]) error {
+		var encoded []TsSample
+		for o := many(); o.HasValue(); o = many() {
+			t, e := TypedSampleEncode(o.Value(), kc, vc)
+			if nil != e {
+				return e
+			}
+			encoded = append(encoded, t)
+		}
+		return bset(ctx, s2k.IterFromArray(encoded))
+	}
+}
+
+func TypedGetNew[K, V any](read PartitionRead, kc Codec[K], vc Codec[V]) TypedGet[K, V] {
+	return func(ctx context.Context, id string, date time.Time) (decoded []TypedSample[K, V], e error) {
+		samples, e := read(ctx, id, date)
+		if nil != e {
+			return nil, e
+		}
+		for o := samples(); o.HasValue(); o = samples() {
+			s, e := TypedSampleDecode(o.Value(), kc, vc)
+			if nil != e {
+				return nil, e
+			}
+			decoded = append(decoded, s)
+		}
+		return decoded, nil
+	}
+}
@@ -0,0 +1,86 @@
+package stdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	s2k "github.com/takanoriyanagitani/go-sql2keyval"
+)
+
+func TestTyped(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 0, 0, 0, 0, time.UTC)
+
+	t.Run("TypedSetNew", func(t *testing.T) {
+		t.Parallel()
+
+		kv := memKvNew()
+		var set Set = NewSetter(kv.AddBucket, kv.Set)(YmdConverter, &SimpleCommandRunner{})
+		var tset TypedSet[time.Time, float64] = TypedSetNew(set, TimeCodec, Float64Codec)
+
+		e := tset(context.Background(), "i3776", dt, dt.Add(time.Second), 36.5)
+		if nil != e {
+			t.Fatalf("Unable to set: %v", e)
+		}
+
+		var tget TypedGet[time.Time, float64] = TypedGetNew(
+			NewPartitionReader(kv.Lst, kv.Get)(YmdConverter),
+			TimeCodec,
+			Float64Codec,
+		)
+		got, e := tget(context.Background(), "i3776", dt)
+		if nil != e {
+			t.Fatalf("Unable to get: %v", e)
+		}
+		checker(1, len(got), t)
+		checker("i3776", got[0].Id, t)
+		checker(dt.Add(time.Second), got[0].Key, t)
+		checker(36.5, got[0].Val, t)
+	})
+
+	t.Run("TypedBatchSetNew", func(t *testing.T) {
+		t.Parallel()
+
+		kv := memKvNew()
+		var bset BatchSet = NewBatchSetter(kv.AddBucket, kv.SetBatch, 16)(YmdConverter)
+		var tbset TypedBatchSet[int64, string] = TypedBatchSetNew(bset, Int64Codec, StringCodec)
+
+		e := tbset(context.Background(), s2k.IterFromArray([]TypedSample[int64, string]{
+			{Id: "i634", Date: dt, Key: 2, Val: "b"},
+			{Id: "i634", Date: dt, Key: 1, Val: "a"},
+		}))
+		if nil != e {
+			t.Fatalf("Unable to set: %v", e)
+		}
+
+		var tget TypedGet[int64, string] = TypedGetNew(
+			NewPartitionReader(kv.Lst, kv.Get)(YmdConverter),
+			Int64Codec,
+			StringCodec,
+		)
+		got, e := tget(context.Background(), "i634", dt)
+		if nil != e {
+			t.Fatalf("Unable to get: %v", e)
+		}
+		checker(2, len(got), t)
+		checker(int64(1), got[0].Key, t)
+		checker("a", got[0].Val, t)
+	})
+
+	t.Run("decode error", func(t *testing.T) {
+		t.Parallel()
+
+		var read PartitionRead = func(_ context.Context, id string, date time.Time) (s2k.Iter[TsSample], error) {
+			return s2k.IterFromArray([]TsSample{
+				TsSampleNew(id, date, []byte("short"), []byte("v")),
+			}), nil
+		}
+		var tget TypedGet[int64, string] = TypedGetNew(read, Int64Codec, StringCodec)
+		_, e := tget(context.Background(), "i333", dt)
+		if nil == e {
+			t.Errorf("Must fail")
+		}
+	})
+}
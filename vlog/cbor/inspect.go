@@ -0,0 +1,109 @@
+package vlcb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+var ErrNoDate = errors.New("no date")
+
+// Record is a record found in a packed vlog.
+// Err is not nil if the record is malformed(Sample may be incomplete).
+type Record struct {
+	Offset int
+	Size   int
+	Sample SampleDto
+	Err    error
+}
+
+func (r Record) Valid() bool { return nil == r.Err }
+
+// parseRecord decodes the first record; the size is 0 if the record is not well-formed.
+func parseRecord(b []byte) (size int, s SampleDto, e error) {
+	dec := cbor.NewDecoder(bytes.NewReader(b))
+	var raw cbor.RawMessage
+	e = dec.Decode(&raw)
+	if errors.Is(e, io.EOF) {
+		return 0, s, io.ErrUnexpectedEOF // the decoder reports truncated records as io.EOF
+	}
+	if nil != e {
+		return 0, s, e
+	}
+	size = dec.NumBytesRead()
+	s, e = FromDecoder(cbor.NewDecoder(bytes.NewReader(raw)))
+	if nil != e {
+		return size, s, e
+	}
+	if s.Date.IsZero() {
+		return size, s, ErrNoDate
+	}
+	return size, s, nil
+}
+
+// recordHead checks if the byte can be the head of a record(cbor array or map).
+func recordHead(b byte) bool { return 0x80 <= b && b <= 0xbf }
+
+// resync finds the offset of the next record which can be decoded as a SampleDto(or the end).
+// Only the offsets of cbor array/map heads are decoded.
+func resync(packed []byte, offset int) int {
+	for ; offset < len(packed); offset++ {
+		if !recordHead(packed[offset]) {
+			continue
+		}
+		_, _, e := parseRecord(packed[offset:])
+		if nil == e || errors.Is(e, ErrNoDate) {
+			return offset
+		}
+	}
+	return len(packed)
+}
+
+// Walk calls f for each record(including malformed ones) in the packed vlog.
+// Bytes which are not well-formed cbor are reported as a record until the next valid record.
+func Walk(packed []byte, f func(r Record) error) error {
+	for offset := 0; offset < len(packed); {
+		size, s, e := parseRecord(packed[offset:])
+		if 0 == size {
+			size = resync(packed, offset+1) - offset
+		}
+		ef := f(Record{Offset: offset, Size: size, Sample: s, Err: e})
+		if nil != ef {
+			return ef
+		}
+		offset += size
+	}
+	return nil
+}
+
+// Repair gets the valid records(as is) and the number of malformed records.
+func Repair(packed []byte) (repaired []byte, malformed int) {
+	_ = Walk(packed, func(r Record) error {
+		if r.Valid() {
+			repaired = append(repaired, packed[r.Offset:r.Offset+r.Size]...)
+		} else {
+			malformed += 1
+		}
+		return nil
+	})
+	return
+}
+
+func (r Record) String() string {
+	if !r.Valid() {
+		return fmt.Sprintf("%d\t%d\tmalformed: %v", r.Offset, r.Size, r.Err)
+	}
+	return fmt.Sprintf(
+		"%d\t%d\t%s\t%s\tkey=%d\tval=%d",
+		r.Offset,
+		r.Size,
+		r.Sample.Id,
+		r.Sample.Date.Format(time.RFC3339Nano),
+		len(r.Sample.Key),
+		len(r.Sample.Val),
+	)
+}
@@ -0,0 +1,96 @@
+package vlcb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWalk(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(2022, time.August, 26, 13, 14, 15, 0, time.UTC)
+	pack := func(s SampleDto) []byte {
+		var buf bytes.Buffer
+		packed, _ := s.ToBytes(&buf)
+		return packed
+	}
+	r0 := pack(SampleDto{Id: "cafef00d", Date: dt, Key: []byte("k0"), Val: []byte("v00")})
+	r1 := pack(SampleDto{Id: "cafef00d", Date: dt, Key: []byte("k1"), Val: []byte("v1")})
+	nodate := pack(SampleDto{Id: "cafef00d"})
+	garbage := []byte{0xff, 0xfe}
+
+	var packed []byte
+	packed = append(packed, r0...)
+	packed = append(packed, garbage...)
+	packed = append(packed, nodate...)
+	packed = append(packed, r1...)
+	packed = append(packed, r0[:len(r0)-2]...) // truncated
+
+	t.Run("Walk", func(t *testing.T) {
+		t.Parallel()
+
+		var records []Record
+		e := Walk(packed, func(r Record) error {
+			records = append(records, r)
+			return nil
+		})
+		if nil != e {
+			t.Fatalf("Unable to walk: %v", e)
+		}
+		checker(t, len(records), 5)
+
+		checker(t, records[0].Valid(), true)
+		checker(t, records[0].Offset, 0)
+		checker(t, records[0].Size, len(r0))
+		checker(t, len(records[0].Sample.Val), 3)
+
+		checker(t, records[1].Valid(), false)
+		checker(t, records[1].Offset, len(r0))
+		checker(t, records[1].Size, len(garbage))
+
+		checker(t, errors.Is(records[2].Err, ErrNoDate), true)
+		checker(t, records[2].Size, len(nodate))
+
+		checker(t, records[3].Valid(), true)
+		checkerBytes(t, records[3].Sample.Key, []byte("k1"))
+
+		checker(t, errors.Is(records[4].Err, io.ErrUnexpectedEOF), true)
+		checker(t, records[4].Offset+records[4].Size, len(packed))
+	})
+
+	t.Run("Repair", func(t *testing.T) {
+		t.Parallel()
+
+		repaired, malformed := Repair(packed)
+		checker(t, malformed, 3)
+		checkerBytes(t, repaired, append(append([]byte(nil), r0...), r1...))
+
+		unpacked, _ := CborVlogNew().Unpack(repaired)
+		checker(t, len(unpacked), 2)
+
+		repaired, malformed = Repair(nil)
+		checker(t, malformed, 0)
+		checker(t, len(repaired), 0)
+	})
+
+	t.Run("resync", func(t *testing.T) {
+		t.Parallel()
+
+		var noise []byte = bytes.Repeat([]byte{0x00, 0xff, 0xa1}, 1024) // 0xa1: map head
+		var b []byte = append(append([]byte(nil), noise...), r1...)
+		checker(t, resync(b, 1), len(noise))
+		checker(t, resync(noise, 0), len(noise))
+		checker(t, recordHead(r1[0]), true)
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		t.Parallel()
+
+		var stop error = errors.New("stop")
+		e := Walk(packed, func(_ Record) error { return stop })
+		checker(t, e, stop)
+	})
+}
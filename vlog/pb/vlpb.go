@@ -0,0 +1,201 @@
+package vlpb
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+	"github.com/takanoriyanagitani/go-spacetimedb/internal/pbwire"
+)
+
+// field numbers(see sample.proto)
+const (
+	fieldId   protowire.Number = 1
+	fieldDate protowire.Number = 2
+	fieldKey  protowire.Number = 3
+	fieldVal  protowire.Number = 4
+
+	fieldSeconds protowire.Number = 1
+	fieldNanos   protowire.Number = 2
+)
+
+type PbPack func(samples []sp.TsSample) (packed []byte, e error)
+type PbUnpack func(packed []byte) (unpacked []sp.TsSample, e error)
+
+type pbVlog struct {
+	packer   PbPack
+	unpacker PbUnpack
+}
+
+func PbVlogNew() *pbVlog {
+	return &pbVlog{
+		packer:   newPacker(),
+		unpacker: newUnpacker(),
+	}
+}
+
+func (p *pbVlog) Pack(samples []sp.TsSample) ([]byte, error)  { return p.packer(samples) }
+func (p *pbVlog) Unpack(packed []byte) ([]sp.TsSample, error) { return p.unpacker(packed) }
+func (p *pbVlog) AsVlog() sp.Vlog                             { return p }
+
+type SampleDto struct {
+	Id   string
+	Date time.Time
+	Key  []byte
+	Val  []byte
+}
+
+func (s *SampleDto) UseId(id string)      { s.Id = id }
+func (s *SampleDto) UseDate(dt time.Time) { s.Date = dt }
+func (s *SampleDto) UseKey(k []byte)      { s.Key = k }
+func (s *SampleDto) UseVal(v []byte)      { s.Val = v }
+
+func (s *SampleDto) ToSample() sp.TsSample {
+	return sp.TsSampleNew(
+		s.Id,
+		s.Date,
+		s.Key,
+		s.Val,
+	)
+}
+
+// AppendTimestamp appends the google.protobuf.Timestamp message(without length prefix).
+func AppendTimestamp(b []byte, t time.Time) []byte {
+	var seconds int64 = t.Unix()
+	var nanos int64 = int64(t.Nanosecond())
+	if 0 != seconds {
+		b = protowire.AppendTag(b, fieldSeconds, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(seconds))
+	}
+	if 0 != nanos {
+		b = protowire.AppendTag(b, fieldNanos, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(nanos))
+	}
+	return b
+}
+
+// AppendMessage appends the Sample message(without length prefix).
+// Fields are written in field number order and empty fields are omitted,
+// which matches the canonical output of protobuf encoders.
+func (s *SampleDto) AppendMessage(b []byte) []byte {
+	if 0 < len(s.Id) {
+		b = protowire.AppendTag(b, fieldId, protowire.BytesType)
+		b = protowire.AppendString(b, s.Id)
+	}
+
+	b = protowire.AppendTag(b, fieldDate, protowire.BytesType)
+	b = protowire.AppendBytes(b, AppendTimestamp(nil, s.Date))
+
+	if 0 < len(s.Key) {
+		b = protowire.AppendTag(b, fieldKey, protowire.BytesType)
+		b = protowire.AppendBytes(b, s.Key)
+	}
+	if 0 < len(s.Val) {
+		b = protowire.AppendTag(b, fieldVal, protowire.BytesType)
+		b = protowire.AppendBytes(b, s.Val)
+	}
+	return b
+}
+
+// AppendDelimited appends the size prefixed Sample message.
+func (s *SampleDto) AppendDelimited(b []byte) []byte {
+	return protowire.AppendBytes(b, s.AppendMessage(nil))
+}
+
+// ConsumeTimestamp parses a google.protobuf.Timestamp message(without length prefix).
+func ConsumeTimestamp(b []byte) (t time.Time, e error) {
+	var seconds int64
+	var nanos int64
+	e = pbwire.ConsumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if protowire.VarintType != typ || (fieldSeconds != num && fieldNanos != num) {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+		v, n := protowire.ConsumeVarint(b)
+		if fieldSeconds == num {
+			seconds = int64(v)
+		} else {
+			nanos = int64(int32(v))
+		}
+		return n, nil
+	})
+	if nil != e {
+		return t, e
+	}
+	if nanos < 0 || 1e9 <= nanos {
+		return t, fmt.Errorf("Invalid nanos: %v", nanos)
+	}
+	return time.Unix(seconds, nanos).UTC(), nil
+}
+
+func consumeBytes(b []byte) (val []byte, n int, e error) {
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return nil, n, protowire.ParseError(n)
+	}
+	return append([]byte(nil), v...), n, nil
+}
+
+// FromMessage parses a Sample message(without length prefix).
+// Unknown fields are skipped.
+func FromMessage(b []byte) (unpacked SampleDto, e error) {
+	unpacked.Date = time.Unix(0, 0).UTC()
+	e = pbwire.ConsumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if protowire.BytesType != typ {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+		field, n, e := consumeBytes(b)
+		if nil != e {
+			return n, e
+		}
+		switch num {
+		case fieldId:
+			unpacked.Id = string(field)
+		case fieldDate:
+			unpacked.Date, e = ConsumeTimestamp(field)
+		case fieldKey:
+			unpacked.Key = field
+		case fieldVal:
+			unpacked.Val = field
+		}
+		return n, e
+	})
+	return
+}
+
+// FromDelimited parses a size prefixed Sample message.
+// Returns the number of bytes consumed.
+func FromDelimited(b []byte) (unpacked SampleDto, n int, e error) {
+	msg, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return unpacked, 0, protowire.ParseError(n)
+	}
+	unpacked, e = FromMessage(msg)
+	return
+}
+
+func newPacker() PbPack {
+	return func(samples []sp.TsSample) (packed []byte, e error) {
+		for _, ts := range samples {
+			var s SampleDto
+			ts.ForUser(&s)
+			packed = s.AppendDelimited(packed)
+		}
+		return packed, nil
+	}
+}
+
+func newUnpacker() PbUnpack {
+	return func(packed []byte) (unpacked []sp.TsSample, e error) {
+		for 0 < len(packed) {
+			u, n, e := FromDelimited(packed)
+			if nil != e {
+				return unpacked, e
+			}
+			unpacked = append(unpacked, u.ToSample())
+			packed = packed[n:]
+		}
+		return unpacked, nil
+	}
+}
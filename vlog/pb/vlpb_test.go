@@ -0,0 +1,160 @@
+package vlpb
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	sp "github.com/takanoriyanagitani/go-spacetimedb"
+)
+
+func checkerNew[T any](comp func(got T, expected T) bool) func(t *testing.T, got, expected T) {
+	return func(t *testing.T, got, expected T) {
+		if !comp(got, expected) {
+			t.Errorf("Unexpected value got.\n")
+			t.Errorf("expected: %v\n", expected)
+			t.Errorf("got:      %v\n", got)
+		}
+	}
+}
+
+var checkerBytes = checkerNew(func(a, b []byte) bool { return 0 == bytes.Compare(a, b) })
+
+func checker[T comparable](t *testing.T, got T, expected T) {
+	checkerNew(func(a, b T) bool { return a == b })(t, got, expected)
+}
+
+func TestVlpb(t *testing.T) {
+	t.Parallel()
+
+	var dt time.Time = time.Date(
+		1970, time.January, 1, 23, 59, 59, 0, time.UTC,
+	)
+
+	// the bytes below must never change(wire compatibility)
+	golden := []byte{
+		0x12,                           // size
+		0x0a, 0x04, 'i', 'd', 'i', 'd', // id
+		0x12, 0x04, 0x08, 0xff, 0xa2, 0x05, // date(seconds: 86399)
+		0x1a, 0x01, 'k', // key
+		0x22, 0x01, 'v', // val
+	}
+
+	t.Run("PbVlogNew", func(t *testing.T) {
+		t.Parallel()
+
+		t.Run("Pack/Unpack", func(t *testing.T) {
+			t.Parallel()
+
+			t.Run("empty", func(t *testing.T) {
+				t.Parallel()
+
+				var pv sp.Vlog = PbVlogNew()
+				packed, e := pv.Pack(nil)
+				if nil != e {
+					t.Errorf("Must be nop: %v", e)
+				}
+				if 0 != len(packed) {
+					t.Errorf("Must be empty: %v", len(packed))
+				}
+
+				unpacked, e := pv.Unpack(packed)
+				if nil != e {
+					t.Errorf("Must be nop: %v", e)
+				}
+				checker(t, len(unpacked), 0)
+			})
+
+			t.Run("golden", func(t *testing.T) {
+				t.Parallel()
+
+				var pv sp.Vlog = PbVlogNew()
+				packed, e := pv.Pack([]sp.TsSample{
+					sp.TsSampleNew("idid", dt, []byte("k"), []byte("v")),
+				})
+				if nil != e {
+					t.Errorf("Unable to pack: %v", e)
+				}
+				checkerBytes(t, packed, golden)
+			})
+
+			t.Run("multi", func(t *testing.T) {
+				t.Parallel()
+
+				var pv sp.Vlog = PbVlogNew()
+				var nano time.Time = time.Date(
+					1969, time.December, 31, 23, 59, 59, 123456789, time.UTC,
+				)
+				packed, e := pv.Pack([]sp.TsSample{
+					sp.TsSampleNew("idid", dt, []byte("k"), []byte("v")),
+					sp.TsSampleNew("iidd", nano, nil, []byte("m")),
+				})
+				if nil != e {
+					t.Errorf("Unable to pack: %v", e)
+				}
+
+				unpacked, e := pv.Unpack(packed)
+				if nil != e {
+					t.Errorf("Unable to unpack: %v", e)
+				}
+				if 2 != len(unpacked) {
+					t.Fatalf("Unexpected len: %v", len(unpacked))
+				}
+
+				var sdto SampleDto
+				unpacked[0].ForUser(&sdto)
+				checker(t, sdto.Id, "idid")
+				checker(t, sdto.Date.UnixNano(), dt.UnixNano())
+				checkerBytes(t, sdto.Key, []byte("k"))
+				checkerBytes(t, sdto.Val, []byte("v"))
+
+				unpacked[1].ForUser(&sdto)
+				checker(t, sdto.Id, "iidd")
+				checker(t, sdto.Date.UnixNano(), nano.UnixNano())
+				checker(t, len(sdto.Key), 0)
+				checkerBytes(t, sdto.Val, []byte("m"))
+			})
+
+			t.Run("truncated", func(t *testing.T) {
+				t.Parallel()
+
+				var pv sp.Vlog = PbVlogNew()
+				_, e := pv.Unpack(golden[:len(golden)-1])
+				if nil == e {
+					t.Errorf("Must fail")
+				}
+			})
+		})
+	})
+
+	t.Run("FromMessage", func(t *testing.T) {
+		t.Parallel()
+
+		t.Run("unknown fields", func(t *testing.T) {
+			t.Parallel()
+
+			msg := append([]byte{}, golden[1:]...)
+			msg = append(msg, 0x28, 0x2a)           // field 5(varint): 42
+			msg = append(msg, 0x32, 0x02, 'h', 'i') // field 6(bytes): "hi"
+
+			u, e := FromMessage(msg)
+			if nil != e {
+				t.Errorf("Unknown fields must be skipped: %v", e)
+			}
+			checker(t, u.Id, "idid")
+			checker(t, u.Date.UnixNano(), dt.UnixNano())
+			checkerBytes(t, u.Key, []byte("k"))
+			checkerBytes(t, u.Val, []byte("v"))
+		})
+
+		t.Run("invalid nanos", func(t *testing.T) {
+			t.Parallel()
+
+			msg := []byte{0x12, 0x06, 0x10, 0x80, 0x94, 0xeb, 0xdc, 0x03} // nanos: 1e9
+			_, e := FromMessage(msg)
+			if nil == e {
+				t.Errorf("Must fail")
+			}
+		})
+	})
+}